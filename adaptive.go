@@ -0,0 +1,56 @@
+package snappystream
+
+// MinAdaptiveBlockSize is the smallest block size chosen by a Writer created
+// with WithAdaptiveBlockSize.
+const MinAdaptiveBlockSize = 4096
+
+// Thresholds on the ratio of a block's emitted length to its input length
+// (see Writer.LastBlockRatio) at which an adaptive Writer grows or shrinks
+// its block size.
+const (
+	adaptiveGrowRatio   = 0.5
+	adaptiveShrinkRatio = 0.9
+)
+
+// WithAdaptiveBlockSize causes a Writer to choose the size of the blocks into
+// which it divides writes according to how well recent blocks compressed.
+// The block size doubles, up to MaxBlockSize, after each block that
+// compresses to less than half its size, giving the best ratio and fewest
+// headers for compressible data.  It halves, down to MinAdaptiveBlockSize,
+// after each block that compresses poorly, so that a Writer spends less work
+// on each block of incompressible data before storing it uncompressed.  The
+// current size is reported by Writer.BlockSize.
+//
+// The option affects only how Writer.Write divides its input; WriteBlock and
+// WriteRecord always emit exactly the data given.
+func WithAdaptiveBlockSize() WriterOption {
+	return func(w *Writer) {
+		w.adaptive = true
+	}
+}
+
+// BlockSize returns the largest amount of data w places in a single block
+// when dividing a call to Write.  It is MaxBlockSize unless w was created with
+// WithAdaptiveBlockSize, WithDeterministicBlocks or WithMaxBufferSize.
+func (w *Writer) BlockSize() int {
+	if w.mu != nil {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+	}
+
+	return w.blockSize
+}
+
+// adaptBlockSize adjusts w's block size according to the ratio of the most
+// recently written block.
+func (w *Writer) adaptBlockSize() {
+	switch {
+	case w.lastRatio < adaptiveGrowRatio && w.blockSize < w.maxBlock:
+		w.blockSize *= 2
+		if w.blockSize > w.maxBlock {
+			w.blockSize = w.maxBlock
+		}
+	case w.lastRatio > adaptiveShrinkRatio && w.blockSize > MinAdaptiveBlockSize:
+		w.blockSize /= 2
+	}
+}
@@ -0,0 +1,111 @@
+package snappystream
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// mixedBytes returns n bytes alternating between runs of random and
+// constant data of the given length.
+func mixedBytes(tb testing.TB, n, run int) []byte {
+	p := make([]byte, n)
+	for i := 0; i < n; i += 2 * run {
+		end := i + run
+		if end > n {
+			end = n
+		}
+		_, err := io.ReadFull(rand.Reader, p[i:end])
+		if err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return p
+}
+
+// This test checks that an adaptive Writer shrinks its blocks for
+// incompressible data and grows them for compressible data.
+func TestWriterAdaptiveBlockSize(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithAdaptiveBlockSize())
+	if w.BlockSize() != MaxBlockSize {
+		t.Fatalf("initial block size %d", w.BlockSize())
+	}
+
+	random := mixedBytes(t, 1<<20, 1<<20)
+	_, err := w.Write(random)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if w.BlockSize() != MinAdaptiveBlockSize {
+		t.Errorf("block size %d after random data", w.BlockSize())
+	}
+
+	constant := make([]byte, 1<<20)
+	_, err = w.Write(constant)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if w.BlockSize() != MaxBlockSize {
+		t.Errorf("block size %d after constant data", w.BlockSize())
+	}
+
+	b, err := ioutil.ReadAll(NewReader(&buf, VerifyChecksum))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(b, append(random, constant...)) {
+		t.Fatalf("unequal decompressed content")
+	}
+
+	w = NewWriter(ioutil.Discard)
+	_, err = w.Write(random)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if w.BlockSize() != MaxBlockSize {
+		t.Errorf("non-adaptive block size %d", w.BlockSize())
+	}
+}
+
+// BenchmarkWriterMixed measures encoding data alternating between random and
+// constant runs with fixed size blocks.
+func BenchmarkWriterMixed(b *testing.B) {
+	benchmarkMixed(b, func(w io.Writer) io.WriteCloser {
+		return NewBufferedWriter(w)
+	})
+}
+
+// BenchmarkWriterMixed_adaptive is like BenchmarkWriterMixed but the writer
+// adapts its block size to the data.
+func BenchmarkWriterMixed_adaptive(b *testing.B) {
+	benchmarkMixed(b, func(w io.Writer) io.WriteCloser {
+		return NewBufferedWriter(w, WithAdaptiveBlockSize())
+	})
+}
+
+// benchmarkMixed benchmarks writing mixed data to writers created by enc and
+// logs the resulting compression ratio.
+func benchmarkMixed(b *testing.B, enc func(io.Writer) io.WriteCloser) {
+	p := mixedBytes(b, TestFileSize, 256<<10)
+	var counter countingWriter
+	b.SetBytes(int64(len(p)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		counter.n = 0
+		w := enc(&counter)
+		_, err := w.Write(p)
+		if err != nil {
+			b.Fatal(err)
+		}
+		err = w.Close()
+		if err != nil {
+			b.Fatalf("close: %v", err)
+		}
+	}
+	b.StopTimer()
+	c := float64(len(p)) / float64(counter.n)
+	b.Logf("compression ratio %.03g (%d byte reduction)", c, int64(len(p))-counter.n)
+}
@@ -0,0 +1,44 @@
+// Package bench provides helpers for measuring snappystream against other
+// codecs.  It exercises only the public snappystream API.
+package bench
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/mreiferson/go-snappystream"
+)
+
+// RoundTrip encodes p as a snappy framed stream, decodes the result, and
+// reports the size of the encoded stream along with the time spent encoding
+// and decoding.  An error is returned if either step fails or the decoded
+// data differs from p.
+func RoundTrip(p []byte) (encodedSize int, encode, decode time.Duration, err error) {
+	var enc bytes.Buffer
+	start := time.Now()
+	w := snappystream.NewWriter(&enc)
+	_, err = w.Write(p)
+	if err == nil {
+		err = w.Close()
+	}
+	encode = time.Since(start)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	encodedSize = enc.Len()
+
+	dec := bytes.NewBuffer(make([]byte, 0, len(p)))
+	start = time.Now()
+	_, err = io.Copy(dec, snappystream.NewReader(&enc, snappystream.VerifyChecksum))
+	decode = time.Since(start)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if !bytes.Equal(dec.Bytes(), p) {
+		return 0, 0, 0, errors.New("decoded data does not match input")
+	}
+
+	return encodedSize, encode, decode, nil
+}
@@ -0,0 +1,17 @@
+package bench
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	p := bytes.Repeat([]byte("round trip "), 20000)
+	size, _, _, err := RoundTrip(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size <= 0 || size >= len(p) {
+		t.Fatalf("encoded size %d for %d compressible bytes", size, len(p))
+	}
+}
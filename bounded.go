@@ -0,0 +1,50 @@
+package snappystream
+
+import (
+	"github.com/mreiferson/go-snappystream/snappy-go"
+)
+
+// minBufferSize is the smallest memory ceiling accepted by WithMaxBufferSize.
+const minBufferSize = 64
+
+// WithMaxBufferSize places a hard ceiling of n bytes on the memory a Writer
+// allocates for encoding, for use on memory-constrained devices.  The Writer
+// chooses the largest block size whose worst-case encoded form fits in n
+// bytes along with its block header, and divides writes into blocks of that
+// size, trading compression ratio for the memory otherwise allocated for
+// MaxBlockSize blocks.  The ceiling applies to all of the Writer's internal
+// buffers, regardless of WithPreallocatedDst and WithAdaptiveBlockSize, and
+// WriteBlock, WriteRecord and WithSingleBlockWrites reject blocks larger than
+// the chosen size with a *RecordTooLargeError.  It does not cover data held by
+// the caller, such as app headers, nor the buffer of a BufferedWriter, which
+// holds one block.  n is raised to at least 64.
+func WithMaxBufferSize(n int) WriterOption {
+	return func(w *Writer) {
+		if n < minBufferSize {
+			n = minBufferSize
+		}
+		w.maxBufferSize = n
+
+		// find the largest block whose encoded form fits beside the header.
+		avail := n - len(w.hdr)
+		b := (avail - 32) * 6 / 7
+		for b > 1 && snappy.MaxEncodedLen(b) > avail {
+			b--
+		}
+		if b < w.maxBlock {
+			w.maxBlock = b
+		}
+	}
+}
+
+// MaxBufferSize returns the ceiling on w's internal buffers set with
+// WithMaxBufferSize, or 0 if w's buffers are not limited.
+func (w *Writer) MaxBufferSize() int {
+	return w.maxBufferSize
+}
+
+// maxDstSize returns the size of the encoding buffer needed for the largest
+// block w writes.
+func (w *Writer) maxDstSize() int {
+	return snappy.MaxEncodedLen(w.maxBlock)
+}
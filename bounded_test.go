@@ -0,0 +1,66 @@
+package snappystream
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+// This test checks that a Writer with a memory ceiling keeps its buffers
+// within the ceiling and allocates nothing more for a large write, and that
+// its output decodes.
+func TestWriterMaxBufferSize(t *testing.T) {
+	const ceiling = 16 << 10
+	p := bytes.Repeat(testDataMan, 20)
+
+	w := NewWriter(ioutil.Discard, WithMaxBufferSize(ceiling), WithPreallocatedDst(), WithAdaptiveBlockSize())
+	if n := cap(w.hdr) + cap(w.dst); n > ceiling {
+		t.Errorf("buffers of %d bytes, ceiling %d", n, ceiling)
+	}
+	var err error
+	allocs := testing.AllocsPerRun(10, func() {
+		_, err = w.Write(p)
+	})
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if allocs != 0 {
+		t.Errorf("write made %v allocations", allocs)
+	}
+	if n := cap(w.hdr) + cap(w.dst); n > ceiling {
+		t.Errorf("buffers of %d bytes after write, ceiling %d", n, ceiling)
+	}
+	if w.MaxBufferSize() != ceiling {
+		t.Errorf("max buffer size %d", w.MaxBufferSize())
+	}
+	if w.BlockSize() >= ceiling {
+		t.Errorf("block size %d", w.BlockSize())
+	}
+
+	var buf bytes.Buffer
+	w = NewWriter(&buf, WithMaxBufferSize(ceiling))
+	_, err = w.Write(p)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	b, err := ioutil.ReadAll(NewReader(&buf, VerifyChecksum))
+	if err != nil || !bytes.Equal(b, p) {
+		t.Fatalf("read: %v", err)
+	}
+
+	err = w.WriteBlock(make([]byte, w.BlockSize()+1))
+	var rerr *RecordTooLargeError
+	if !errors.As(err, &rerr) || !errors.Is(err, ErrRecordTooLarge) || rerr.Limit != w.BlockSize() {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	w = NewWriter(ioutil.Discard, WithMaxBufferSize(0))
+	if w.MaxBufferSize() != minBufferSize || w.BlockSize() < 1 {
+		t.Fatalf("max buffer size %d, block size %d", w.MaxBufferSize(), w.BlockSize())
+	}
+	_, err = w.Write(p)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package snappystream
+
+import (
+	"hash/crc32"
+)
+
+// The options in this file exist for interoperability with producers that do
+// not conform to the framing format specification.  Changing the checksum
+// table or mask produces and accepts NON-STANDARD streams: their block
+// checksums fail verification by conformant readers, and conformant streams
+// fail verification by readers configured with these options.  Stream
+// checksum trailers (see WithStreamChecksum) are unaffected.
+
+// WithCRCTable causes a Writer to compute block checksums using table in
+// place of the Castagnoli table required by the specification, such as
+// crc32.IEEETable.  The resulting stream is non-standard.
+func WithCRCTable(table *crc32.Table) WriterOption {
+	return func(w *Writer) {
+		w.crcTable = table
+	}
+}
+
+// WithChecksumMask causes a Writer to mask block checksums using mask in
+// place of DefaultChecksumMask.  The resulting stream is non-standard.
+func WithChecksumMask(mask uint32) WriterOption {
+	return func(w *Writer) {
+		w.checksumMask = mask
+	}
+}
+
+// ReaderCRCTable causes a Reader to verify block checksums using table in
+// place of the Castagnoli table required by the specification.  The Reader
+// then rejects conformant streams when verifying checksums.
+func ReaderCRCTable(table *crc32.Table) ReaderOption {
+	return func(r *Reader) {
+		r.crcTable = table
+	}
+}
+
+// ReaderChecksumMask causes a Reader to unmask block checksums using mask in
+// place of DefaultChecksumMask.  The Reader then rejects conformant streams
+// when verifying checksums.
+func ReaderChecksumMask(mask uint32) ReaderOption {
+	return func(r *Reader) {
+		r.checksumMask = mask
+	}
+}
@@ -0,0 +1,40 @@
+package snappystream
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io/ioutil"
+	"testing"
+)
+
+// This test checks that streams written with a custom checksum table and
+// mask round-trip through a Reader configured to match, and are rejected by
+// a default Reader.
+func TestCustomChecksum(t *testing.T) {
+	data := bytes.Repeat([]byte("custom checksum "), 1000)
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithCRCTable(crc32.IEEETable), WithChecksumMask(0x12345678))
+	_, err := w.Write(data)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	stream := buf.Bytes()
+
+	r := NewReader(bytes.NewReader(stream), true, ReaderCRCTable(crc32.IEEETable), ReaderChecksumMask(0x12345678))
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Fatalf("decoded data does not match")
+	}
+
+	_, err = ioutil.ReadAll(NewReader(bytes.NewReader(stream), true))
+	if err == nil {
+		t.Fatalf("default reader accepted non-standard checksums")
+	}
+	_, err = ioutil.ReadAll(NewReader(bytes.NewReader(stream), true, ReaderCRCTable(crc32.IEEETable)))
+	if err == nil {
+		t.Fatalf("reader accepted checksums with the wrong mask")
+	}
+}
@@ -0,0 +1,74 @@
+package snappystream
+
+import (
+	"github.com/mreiferson/go-snappystream/snappy-go"
+)
+
+// Codec is an implementation of the snappy block format used to compress and
+// decompress the data of framed blocks.  Implementations must produce and
+// accept standard snappy blocks.  Codec decouples the framing logic from a
+// specific snappy implementation.
+type Codec interface {
+	// Encode returns the encoded form of src.  The returned slice may be a
+	// sub-slice of dst if dst was large enough to hold the encoded block.
+	Encode(dst, src []byte) ([]byte, error)
+
+	// Decode returns the decoded form of src.  The returned slice may be a
+	// sub-slice of dst if dst was large enough to hold the decoded block.
+	Decode(dst, src []byte) ([]byte, error)
+}
+
+// LevelCodec is a Codec that supports trading encoding speed for compression
+// ratio.  A Writer created with WithLevel encodes blocks with EncodeLevel if
+// its Codec implements LevelCodec.
+type LevelCodec interface {
+	Codec
+
+	// EncodeLevel is like Encode but encodes src at the given level.  The
+	// meaning of level is defined by the implementation, which should treat
+	// levels it does not support as the nearest one that it does.
+	EncodeLevel(dst, src []byte, level int) ([]byte, error)
+}
+
+// DefaultCodec is the Codec used by Readers and Writers that are not
+// configured with another.  It is the vendored snappy-go implementation.
+var DefaultCodec Codec = snappyCodec{}
+
+// snappyCodec implements Codec using snappy-go.
+type snappyCodec struct{}
+
+func (snappyCodec) Encode(dst, src []byte) ([]byte, error) {
+	return snappy.Encode(dst, src)
+}
+
+func (snappyCodec) Decode(dst, src []byte) ([]byte, error) {
+	return snappy.Decode(dst, src)
+}
+
+// WithCodec causes a Writer to compress blocks using c instead of
+// DefaultCodec.
+func WithCodec(c Codec) WriterOption {
+	return func(w *Writer) {
+		w.codec = c
+	}
+}
+
+// WithLevel causes a Writer to encode blocks at the given compression level if
+// its Codec implements LevelCodec.  The level is ignored by other codecs,
+// including DefaultCodec, which has no levels, so WithLevel can be given
+// unconditionally and takes effect when a codec supporting levels is
+// configured with WithCodec.
+func WithLevel(level int) WriterOption {
+	return func(w *Writer) {
+		w.level = level
+		w.hasLevel = true
+	}
+}
+
+// ReaderCodec causes a Reader to decompress blocks using c instead of
+// DefaultCodec.
+func ReaderCodec(c Codec) ReaderOption {
+	return func(r *Reader) {
+		r.codec = c
+	}
+}
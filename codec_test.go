@@ -0,0 +1,94 @@
+package snappystream
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+// countingCodec is a Codec that counts calls to DefaultCodec.
+type countingCodec struct {
+	encodes int
+	decodes int
+}
+
+func (c *countingCodec) Encode(dst, src []byte) ([]byte, error) {
+	c.encodes++
+	return DefaultCodec.Encode(dst, src)
+}
+
+func (c *countingCodec) Decode(dst, src []byte) ([]byte, error) {
+	c.decodes++
+	return DefaultCodec.Decode(dst, src)
+}
+
+// This test checks that readers and writers use the configured Codec.
+func TestCodec(t *testing.T) {
+	c := &countingCodec{}
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithCodec(c))
+	_, err := w.Write(testDataMan)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if c.encodes != 1 {
+		t.Fatalf("%d encodes", c.encodes)
+	}
+
+	b, err := ioutil.ReadAll(NewReader(&buf, VerifyChecksum, ReaderCodec(c)))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(b, testDataMan) {
+		t.Fatalf("unequal decompressed content")
+	}
+	if c.decodes != 1 {
+		t.Fatalf("%d decodes", c.decodes)
+	}
+}
+
+// levelCodec is a LevelCodec that records the level of each encode.
+type levelCodec struct {
+	countingCodec
+	levels []int
+}
+
+func (c *levelCodec) EncodeLevel(dst, src []byte, level int) ([]byte, error) {
+	c.levels = append(c.levels, level)
+	return DefaultCodec.Encode(dst, src)
+}
+
+// This test checks that WithLevel is passed to codecs supporting levels and
+// ignored by others.
+func TestCodecLevel(t *testing.T) {
+	c := &levelCodec{}
+	w := NewWriter(ioutil.Discard, WithCodec(c), WithLevel(7))
+	_, err := w.Write(testDataMan)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if len(c.levels) != 1 || c.levels[0] != 7 || c.encodes != 0 {
+		t.Fatalf("levels %v, %d encodes", c.levels, c.encodes)
+	}
+
+	c = &levelCodec{}
+	w = NewWriter(ioutil.Discard, WithCodec(c))
+	_, err = w.Write(testDataMan)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if len(c.levels) != 0 || c.encodes != 1 {
+		t.Fatalf("levels %v, %d encodes without level", c.levels, c.encodes)
+	}
+
+	var buf bytes.Buffer
+	w = NewWriter(&buf, WithLevel(7))
+	_, err = w.Write(testDataMan)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	b, err := ioutil.ReadAll(NewReader(&buf, VerifyChecksum))
+	if err != nil || !bytes.Equal(b, testDataMan) {
+		t.Fatalf("read: %v", err)
+	}
+}
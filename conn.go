@@ -0,0 +1,59 @@
+package snappystream
+
+import (
+	"io"
+)
+
+// Conn is an io.ReadWriteCloser carrying a snappy framed stream in each
+// direction of an underlying io.ReadWriter, such as a net.Conn.  Data read from
+// the underlying connection is decoded by a Reader and data written is encoded
+// by a BufferedWriter, so written data is not sent until Flush or Close is
+// called.
+type Conn struct {
+	rw io.ReadWriter
+	r  *Reader
+	w  *BufferedWriter
+}
+
+// NewConn returns a Conn that decodes the stream read from rw, verifying
+// checksums according to verifyChecksum, and encodes the stream written to
+// rw.  The options opts configure the encoding stream.
+func NewConn(rw io.ReadWriter, verifyChecksum bool, opts ...WriterOption) *Conn {
+	return &Conn{
+		rw: rw,
+		r:  NewReader(rw, verifyChecksum),
+		w:  NewBufferedWriter(rw, opts...),
+	}
+}
+
+// Read reads decoded data from the incoming stream.
+func (c *Conn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// Write buffers p for encoding to the outgoing stream.
+func (c *Conn) Write(p []byte) (int, error) {
+	return c.w.Write(p)
+}
+
+// Flush encodes and sends any buffered data to the outgoing stream.
+func (c *Conn) Flush() error {
+	return c.w.Flush()
+}
+
+// Close finalizes the outgoing stream.  If the underlying connection
+// implements CloseWrite, as *net.TCPConn does, it is called to signal the end
+// of the outgoing stream to the peer.  The incoming stream remains readable
+// and the underlying connection is not closed.
+func (c *Conn) Close() error {
+	err := c.w.Close()
+	if err != nil {
+		return err
+	}
+	if cw, ok := c.rw.(interface {
+		CloseWrite() error
+	}); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
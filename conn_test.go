@@ -0,0 +1,56 @@
+package snappystream
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// halfConn is an in-memory io.ReadWriter that records calls to CloseWrite.
+type halfConn struct {
+	io.Reader
+	io.Writer
+	writeClosed bool
+}
+
+func (c *halfConn) CloseWrite() error {
+	c.writeClosed = true
+	return nil
+}
+
+// This test checks that a Conn decodes its read side and encodes its write
+// side, and that Close finalizes only the write side.
+func TestConn(t *testing.T) {
+	var out bytes.Buffer
+	hc := &halfConn{Reader: encodedString("request"), Writer: &out}
+	c := NewConn(hc, true)
+
+	_, err := io.WriteString(c, "response")
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("write sent data before flush")
+	}
+	err = c.Flush()
+	if err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	b, err := ioutil.ReadAll(NewReader(bytes.NewReader(out.Bytes()), true))
+	if err != nil || string(b) != "response" {
+		t.Fatalf("flushed stream %q (%v)", b, err)
+	}
+
+	err = c.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if !hc.writeClosed {
+		t.Fatalf("write side not closed")
+	}
+	b, err = ioutil.ReadAll(c)
+	if err != nil || string(b) != "request" {
+		t.Fatalf("read %q (%v) after close", b, err)
+	}
+}
@@ -0,0 +1,42 @@
+package snappystream
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// NewDeadlineReader returns a Reader that decodes the snappy framed stream
+// read from conn, typically a net.Conn, setting a read deadline of timeout
+// from the current time before reading each chunk.  A stalled peer then causes
+// the Reader to return the timeout error reported by conn rather than block
+// indefinitely; like any read error, the timeout ends decoding of the stream.
+// conn must support read deadlines.  The deadline is replaced before each
+// chunk and left in place afterwards.  After Reset the Reader sets deadlines
+// on the new source if it supports them, and otherwise reads without a
+// deadline.
+func NewDeadlineReader(conn interface {
+	io.Reader
+	SetReadDeadline(t time.Time) error
+}, timeout time.Duration, verifyChecksum bool, opts ...ReaderOption) *Reader {
+	r := NewReader(conn, verifyChecksum, opts...)
+	r.readTimeout = timeout
+	r.setDeadline = deadlineSetter(conn, timeout)
+	return r
+}
+
+// deadlineSetter returns a function setting a read deadline of timeout from
+// the current time on src, or nil if src does not support read deadlines.
+func deadlineSetter(src io.Reader, timeout time.Duration) func() error {
+	conn, ok := src.(interface{ SetReadDeadline(t time.Time) error })
+	if !ok {
+		return nil
+	}
+	return func() error {
+		err := conn.SetReadDeadline(time.Now().Add(timeout))
+		if err != nil {
+			return fmt.Errorf("setting read deadline: %w", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,65 @@
+package snappystream
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// This test checks that a stalled peer causes a deadline reader to time out.
+func TestDeadlineReader(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		w := NewWriter(server)
+		w.Write([]byte("before the stall"))
+	}()
+
+	r := NewDeadlineReader(client, 50*time.Millisecond, true)
+	p, err := r.ReadMessage()
+	if err != nil || string(p) != "before the stall" {
+		t.Fatalf("read %q (%v)", p, err)
+	}
+
+	start := time.Now()
+	_, err = r.ReadMessage()
+	var nerr net.Error
+	if !errors.As(err, &nerr) || !nerr.Timeout() {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("timed out after %v", time.Since(start))
+	}
+}
+
+// This test checks that a deadline reader sets deadlines on the new source
+// after Reset.
+func TestDeadlineReaderReset(t *testing.T) {
+	first, _ := net.Pipe()
+	defer first.Close()
+	r := NewDeadlineReader(first, 50*time.Millisecond, true)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	r.Reset(client)
+	start := time.Now()
+	_, err := r.ReadMessage()
+	var nerr net.Error
+	if !errors.As(err, &nerr) || !nerr.Timeout() {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("timed out after %v", time.Since(start))
+	}
+
+	// a source without deadlines is read without them.
+	r.Reset(encodedString("no deadline"))
+	p, err := r.ReadMessage()
+	if err != nil || string(p) != "no deadline" {
+		t.Fatalf("read %q (%v)", p, err)
+	}
+}
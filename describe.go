@@ -0,0 +1,117 @@
+package snappystream
+
+import (
+	"errors"
+	"io"
+)
+
+// ChunkInfo describes a single chunk of a snappy framed stream.
+type ChunkInfo struct {
+	Offset int64 // offset of the chunk in the stream
+	Type   byte  // chunk type (the first byte of its header)
+	Length int   // length of the chunk data, excluding the 4-byte header
+
+	// The following fields are only set for data blocks (types 0x00 and
+	// 0x01).  DecodedLen is -1 if the block data could not be decoded.
+	Compressed    bool
+	DecodedLen    int
+	ChecksumValid bool
+}
+
+// StreamDescription describes the chunks of a snappy framed stream, in order,
+// as returned by DescribeStream.
+type StreamDescription []ChunkInfo
+
+// PaddingChunks returns the number of padding chunks (type 0xfe) in d, as
+// counted by Reader.PaddingChunks.
+func (d StreamDescription) PaddingChunks() int64 {
+	return d.count(func(info ChunkInfo) bool { return info.Type == blockPadding })
+}
+
+// SkippableChunks returns the number of reserved skippable chunks (types
+// 0x80-0xfd) in d, as counted by Reader.SkippableChunks.
+func (d StreamDescription) SkippableChunks() int64 {
+	return d.count(func(info ChunkInfo) bool { return 0x80 <= info.Type && info.Type <= 0xfd })
+}
+
+// DataBlocks returns the number of data blocks in d that decoded with a valid
+// checksum, as counted by Reader.DataBlocks.
+func (d StreamDescription) DataBlocks() int64 {
+	return d.count(func(info ChunkInfo) bool {
+		return (info.Type == blockCompressed || info.Type == blockUncompressed) && info.ChecksumValid
+	})
+}
+
+// count returns the number of chunks in d satisfying f.
+func (d StreamDescription) count(f func(info ChunkInfo) bool) int64 {
+	var n int64
+	for _, info := range d {
+		if f(info) {
+			n++
+		}
+	}
+	return n
+}
+
+// DescribeStream reads a snappy framed stream from r and returns a
+// description of each chunk it contains, in order, from which the counts of
+// each kind of chunk are also available.  DescribeStream is a
+// diagnostic aid for malformed streams and does not validate stream structure
+// (e.g. a missing stream identifier or unskippable chunks).  Data blocks are
+// decoded one at a time to determine their length and checksum validity but
+// the decoded content is discarded.
+//
+// If an error occurs reading r the chunks described before the error are
+// returned along with the error.
+func DescribeStream(r io.Reader) (StreamDescription, error) {
+	_r := NewReader(r, SkipVerifyChecksum)
+	var chunks StreamDescription
+	for {
+		info, err := _r.describeChunk()
+		if err == io.EOF {
+			return chunks, nil
+		}
+		if err != nil {
+			return chunks, err
+		}
+		chunks = append(chunks, info)
+	}
+}
+
+// describeChunk reads the next chunk from r and returns its description.
+// Data blocks are decoded as by nextBlock, with r created not to verify
+// checksums, and corruption is recorded in the description.
+func (r *Reader) describeChunk() (ChunkInfo, error) {
+	err := r.readHeader()
+	if err != nil {
+		return ChunkInfo{}, err
+	}
+
+	info := ChunkInfo{
+		Offset: r.chunkOffset,
+		Type:   r.hdr[0],
+		Length: int(decodeLength(r.hdr[1:])),
+	}
+	if info.Type != blockCompressed && info.Type != blockUncompressed {
+		return info, r.discardBlock()
+	}
+
+	info.Compressed = info.Type == blockCompressed
+	info.DecodedLen = -1
+	if r.checkBlockHeader() != nil {
+		return info, r.discardBlock()
+	}
+	p, err := r.decodeBlock()
+	var cerr *CorruptionError
+	var tooLarge *BlockTooLargeError
+	switch {
+	case err == nil:
+		info.DecodedLen = len(p)
+		info.ChecksumValid = r.checkLast() == nil
+	case errors.As(err, &tooLarge) && tooLarge.Decoded:
+		info.DecodedLen = int(tooLarge.Length)
+	case !errors.As(err, &cerr):
+		return info, err
+	}
+	return info, nil
+}
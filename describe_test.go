@@ -0,0 +1,75 @@
+package snappystream
+
+import (
+	"bytes"
+	"testing"
+)
+
+// This test checks the chunk-by-chunk description of a stream.
+func TestDescribeStream(t *testing.T) {
+	corrupt := compressedChunk(t, []byte("a corrupt block"))
+	copy(corrupt[4:8], make([]byte, 4)) // crc checksum failure
+	stream := bytes.Join([][]byte{
+		streamID,
+		compressedChunk(t, bytes.Repeat([]byte("a"), 1000)),
+		opaqueChunk(0xfe, 100),
+		uncompressedChunk(t, []byte("raw")),
+		opaqueChunk(0x03, 10),
+		corrupt,
+	}, nil)
+
+	chunks, err := DescribeStream(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatalf("describe: %v", err)
+	}
+	if len(chunks) != 6 {
+		t.Fatalf("described %d chunks", len(chunks))
+	}
+
+	var offset int64
+	for i, c := range chunks {
+		if c.Offset != offset {
+			t.Errorf("chunk %d: offset %d != %d", i, c.Offset, offset)
+		}
+		offset += int64(c.Length) + 4
+	}
+	if offset != int64(len(stream)) {
+		t.Errorf("chunks cover %d bytes of %d", offset, len(stream))
+	}
+
+	if c := chunks[0]; c.Type != blockStreamIdentifier || c.Length != 6 {
+		t.Errorf("stream identifier: %+v", c)
+	}
+	if c := chunks[1]; !c.Compressed || c.DecodedLen != 1000 || !c.ChecksumValid {
+		t.Errorf("compressed block: %+v", c)
+	}
+	if c := chunks[2]; c.Type != blockPadding || c.Length != 100 {
+		t.Errorf("padding: %+v", c)
+	}
+	if c := chunks[3]; c.Compressed || c.DecodedLen != 3 || !c.ChecksumValid {
+		t.Errorf("uncompressed block: %+v", c)
+	}
+	if c := chunks[4]; c.Type != 0x03 || c.Length != 10 {
+		t.Errorf("unskippable chunk: %+v", c)
+	}
+	if c := chunks[5]; !c.Compressed || c.ChecksumValid {
+		t.Errorf("corrupt block: %+v", c)
+	}
+
+	if chunks.PaddingChunks() != 1 || chunks.SkippableChunks() != 0 || chunks.DataBlocks() != 2 {
+		t.Errorf("counted %d padding, %d skippable, %d data", chunks.PaddingChunks(), chunks.SkippableChunks(), chunks.DataBlocks())
+	}
+	skippable, err := DescribeStream(bytes.NewReader(bytes.Join([][]byte{streamID, opaqueChunk(chunkAppHeader, 10), opaqueChunk(0xfd, 4)}, nil)))
+	if err != nil || skippable.SkippableChunks() != 2 {
+		t.Errorf("counted %d skippable (%v)", skippable.SkippableChunks(), err)
+	}
+
+	// truncated streams report the chunks that were read.
+	chunks, err = DescribeStream(bytes.NewReader(stream[:len(stream)-1]))
+	if err == nil {
+		t.Fatalf("describe: expected error")
+	}
+	if len(chunks) != 5 {
+		t.Fatalf("described %d chunks", len(chunks))
+	}
+}
@@ -0,0 +1,75 @@
+package snappystream
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"hash/crc64"
+)
+
+// NewCRC64Digest returns a hash.Hash computing the CRC-64 checksum using the
+// ISO polynomial, for use with WithStreamDigest and VerifyStreamDigest.
+func NewCRC64Digest() hash.Hash {
+	return crc64.New(crc64.MakeTable(crc64.ISO))
+}
+
+// NewSHA256Digest returns a hash.Hash computing the SHA-256 checksum, for use
+// with WithStreamDigest and VerifyStreamDigest.
+func NewSHA256Digest() hash.Hash {
+	return sha256.New()
+}
+
+// WithStreamDigest causes a Writer to feed all uncompressed data written to
+// the stream through h and emit the resulting sum in a trailing skippable chunk
+// when the Writer is closed.  The digest supplements, and does not replace,
+// the per-block checksums.  Readers ignore the trailer unless created with the
+// VerifyStreamDigest option using the same hash algorithm.
+func WithStreamDigest(h hash.Hash) WriterOption {
+	return func(w *Writer) {
+		w.streamDigest = h
+	}
+}
+
+// VerifyStreamDigest causes a Reader to feed all decoded data through h and
+// compare the sum against the trailer written by a Writer created with
+// WithStreamDigest.  A mismatch is reported as ErrStreamChecksum wrapped in a
+// *CorruptionError.  A stream that ends without a digest trailer is reported as
+// io.ErrUnexpectedEOF.  As with VerifyStreamChecksum, each trailer covers the
+// data decoded since the previous trailer.
+func VerifyStreamDigest(h hash.Hash) ReaderOption {
+	return func(r *Reader) {
+		r.streamDigest = h
+	}
+}
+
+// writeStreamDigest writes a skippable chunk containing the sum of the
+// stream digest.
+func (w *Writer) writeStreamDigest() error {
+	sum := w.streamDigest.Sum(nil)
+	n := len(sum)
+	chunk := make([]byte, 4, 4+n)
+	chunk[0] = chunkStreamDigest
+	chunk[1] = byte(n)
+	chunk[2] = byte(n >> 8)
+	chunk[3] = byte(n >> 16)
+	return w.writeAll(append(chunk, sum...))
+}
+
+// readStreamDigest reads a stream digest trailer and compares it against the
+// digest of the data decoded since the previous trailer.
+func (r *Reader) readStreamDigest() error {
+	buf, err := r.readBlock()
+	if err != nil {
+		return err
+	}
+	if len(buf) != r.streamDigest.Size() {
+		return r.corrupt(fmt.Errorf("invalid stream digest length %d", len(buf)))
+	}
+	if !bytes.Equal(buf, r.streamDigest.Sum(nil)) {
+		return r.corrupt(ErrStreamChecksum)
+	}
+	r.streamDigest.Reset()
+	r.seenStreamDigest = true
+	return nil
+}
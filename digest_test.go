@@ -0,0 +1,88 @@
+package snappystream
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// This test checks that stream digests written with WithStreamDigest are
+// verified by a Reader created with VerifyStreamDigest.
+func TestStreamDigest(t *testing.T) {
+	for _, newHash := range []func() hash.Hash{NewCRC64Digest, NewSHA256Digest} {
+		data := bytes.Repeat([]byte("stream digest "), 10000)
+		var buf bytes.Buffer
+		w := NewWriter(&buf, WithStreamDigest(newHash()))
+		_, err := w.Write(data)
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		err = w.Close()
+		if err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		stream := buf.Bytes()
+
+		b, err := ioutil.ReadAll(NewReader(bytes.NewReader(stream), true, VerifyStreamDigest(newHash())))
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if !bytes.Equal(b, data) {
+			t.Fatalf("decoded data does not match")
+		}
+
+		// readers not verifying the digest ignore the trailer.
+		b, err = ioutil.ReadAll(NewReader(bytes.NewReader(stream), true))
+		if err != nil || !bytes.Equal(b, data) {
+			t.Fatalf("read without verifying digest: %v", err)
+		}
+
+		// a corrupt digest is detected.
+		bad := append([]byte{}, stream...)
+		bad[len(bad)-1] ^= 0xff
+		_, err = ioutil.ReadAll(NewReader(bytes.NewReader(bad), true, VerifyStreamDigest(newHash())))
+		if !errors.Is(err, ErrStreamChecksum) {
+			t.Fatalf("read corrupt digest: %v", err)
+		}
+
+		// a missing digest is detected.
+		trailer := newHash().Size() + 4
+		_, err = ioutil.ReadAll(NewReader(bytes.NewReader(stream[:len(stream)-trailer]), true, VerifyStreamDigest(newHash())))
+		if err != io.ErrUnexpectedEOF {
+			t.Fatalf("read missing digest: %v", err)
+		}
+	}
+}
+
+// This test checks that stream digests are verified across concatenated and
+// appended streams.
+func TestStreamDigestConcatenated(t *testing.T) {
+	var buf bytes.Buffer
+	for _, w := range []*Writer{
+		NewWriter(&buf, WithStreamDigest(NewCRC64Digest())),
+		NewWriter(&buf, WithStreamDigest(NewCRC64Digest())),
+		NewAppender(&buf, WithStreamDigest(NewCRC64Digest())),
+		NewWriter(&buf, WithStreamDigest(NewCRC64Digest()), WithResyncInterval(10)),
+	} {
+		for i := 0; i < 3; i++ {
+			_, err := w.Write([]byte("digested "))
+			if err != nil {
+				t.Fatalf("write: %v", err)
+			}
+		}
+		err := w.Close()
+		if err != nil {
+			t.Fatalf("close: %v", err)
+		}
+	}
+	b, err := ioutil.ReadAll(NewReader(&buf, true, VerifyStreamDigest(NewCRC64Digest())))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(b, bytes.Repeat([]byte("digested "), 12)) {
+		t.Fatalf("decoded %q", b)
+	}
+}
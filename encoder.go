@@ -0,0 +1,70 @@
+package snappystream
+
+import (
+	"io"
+)
+
+// An Encoder writes data to a snappy framed stream in the style of the
+// standard library's streaming encoders.  It is a thin layer over Writer.
+type Encoder struct {
+	w *Writer
+}
+
+// NewEncoder returns an Encoder writing a snappy framed stream to w.  The
+// options opts configure the underlying Writer.
+func NewEncoder(w io.Writer, opts ...WriterOption) *Encoder {
+	return &Encoder{w: NewWriter(w, opts...)}
+}
+
+// Encode writes p to the stream.  Data is written immediately, as a single
+// block if p holds no more than MaxBlockSize bytes (or the smaller limit set
+// by WithMaxBufferSize), so that a Decoder reading the stream returns p from
+// one call to Decode.  This holds for an empty p, and regardless of
+// WithAdaptiveBlockSize.  Larger data is divided into several blocks.
+func (e *Encoder) Encode(p []byte) error {
+	if len(p) <= e.w.maxBlock {
+		return e.w.WriteBlock(p)
+	}
+	_, err := e.w.Write(p)
+	return err
+}
+
+// Flush flushes the underlying writer, if it has a Flush method (see
+// WithFlushEachBlock).  The Encoder itself does not buffer data.
+func (e *Encoder) Flush() error {
+	if e.w.mu != nil {
+		e.w.mu.Lock()
+		defer e.w.mu.Unlock()
+	}
+
+	if e.w.err != nil {
+		return e.w.err
+	}
+	return e.w.flushUnderlying()
+}
+
+// Close finalizes the stream.  See Writer.Close.
+func (e *Encoder) Close() error {
+	return e.w.Close()
+}
+
+// A Decoder reads data from a snappy framed stream in the style of the
+// standard library's streaming decoders.  It is a thin layer over Reader.
+type Decoder struct {
+	r *Reader
+}
+
+// NewDecoder returns a Decoder reading a snappy framed stream from r and
+// verifying block checksums.  The options opts configure the underlying
+// Reader.
+func NewDecoder(r io.Reader, opts ...ReaderOption) *Decoder {
+	return &Decoder{r: NewReader(r, VerifyChecksum, opts...)}
+}
+
+// Decode returns the decoded contents of the next data block in the stream as
+// a newly allocated slice, which for data written by Encode is the data of one
+// call to Encode that did not exceed MaxBlockSize bytes.  At the end of the
+// stream Decode returns io.EOF.  See Reader.ReadMessage.
+func (d *Decoder) Decode() ([]byte, error) {
+	return d.r.ReadMessage()
+}
@@ -0,0 +1,46 @@
+package snappystream
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// This test checks that each message encoded by an Encoder is returned by one
+// call to Decode, including empty messages and under WithAdaptiveBlockSize.
+func TestEncoderDecoder(t *testing.T) {
+	for _, opts := range [][]WriterOption{nil, {WithAdaptiveBlockSize()}} {
+		var buf bytes.Buffer
+		e := NewEncoder(&buf, opts...)
+		msgs := [][]byte{[]byte("first"), {}, bytes.Repeat([]byte("second "), 1000), make([]byte, MaxBlockSize)}
+		for _, p := range msgs {
+			err := e.Encode(p)
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+		}
+		err := e.Flush()
+		if err != nil {
+			t.Fatalf("flush: %v", err)
+		}
+		err = e.Close()
+		if err != nil {
+			t.Fatalf("close: %v", err)
+		}
+
+		d := NewDecoder(&buf)
+		for i, want := range msgs {
+			p, err := d.Decode()
+			if err != nil {
+				t.Fatalf("decode %d: %v", i, err)
+			}
+			if !bytes.Equal(p, want) {
+				t.Fatalf("message %d: unequal content", i)
+			}
+		}
+		_, err = d.Decode()
+		if err != io.EOF {
+			t.Fatalf("decode at end of stream: %v", err)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package snappystream
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// FuzzReader feeds arbitrary input to a Reader verifying checksums.  Decoding
+// must either succeed or return an error; it must never panic or grow its
+// internal block buffers beyond the limits of a single block.
+func FuzzReader(f *testing.F) {
+	for _, p := range [][]byte{nil, []byte("a"), testDataMan, testDataJSON, make([]byte, MaxBlockSize+1)} {
+		enc, err := encodeStreamBytes(p, false)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(enc)
+		enc, err = encodeStreamBytes(p, true)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(enc)
+	}
+	f.Add(append(append([]byte(nil), streamID...), 0x00, 0x00, 0x00, 0x00))
+	f.Add(append(append([]byte(nil), streamID...), 0x01, 0x02, 0x00, 0x00, 0x00, 0x00))
+	f.Add(append(append([]byte(nil), streamID...), 0xfe, 0xff, 0xff, 0xff))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := NewReader(bytes.NewReader(data), VerifyChecksum)
+		p := make([]byte, 4096)
+		for {
+			_, err := r.Read(p)
+			if cap(r.dst) > MaxBlockSize {
+				t.Fatalf("decode buffer grew to %d bytes", cap(r.dst))
+			}
+			if cap(r.src) > int(maxEncodedBlockSize)+4 {
+				t.Fatalf("source buffer grew to %d bytes", cap(r.src))
+			}
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,186 @@
+package snappystream
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// BlockEntry locates a single data block within a snappy framed stream.
+type BlockEntry struct {
+	Offset        int64 // offset of the block's chunk in the framed stream
+	DecodedOffset int64 // offset of the block's data in the decoded stream
+	DecodedLen    int   // length of the block's decoded data
+}
+
+// BlockIndex lists the data blocks of a snappy framed stream in stream order.
+type BlockIndex []BlockEntry
+
+// BuildBlockIndex reads the snappy framed stream from r and returns an index
+// of its data blocks.  Blocks are decoded to determine their length but
+// checksums are not verified.
+func BuildBlockIndex(r io.Reader) (BlockIndex, error) {
+	_r := NewReader(r, SkipVerifyChecksum)
+	var index BlockIndex
+	var decoded int64
+	var buf []byte
+	for {
+		p, err := _r.ReadBlock(buf)
+		if err == io.EOF {
+			return index, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		index = append(index, BlockEntry{
+			Offset:        _r.chunkOffset,
+			DecodedOffset: decoded,
+			DecodedLen:    len(p),
+		})
+		decoded += int64(len(p))
+		buf = p
+	}
+}
+
+// lookup returns the position in index of the block whose chunk begins at
+// offset, or -1 if no such block exists.
+func (index BlockIndex) lookup(offset int64) int {
+	i := sort.Search(len(index), func(i int) bool {
+		return index[i].Offset >= offset
+	})
+	if i < len(index) && index[i].Offset == offset {
+		return i
+	}
+	return -1
+}
+
+// BlockReaderAt decodes individual data blocks of a snappy framed stream
+// stored in an io.ReaderAt.  Because blocks are independent, concurrent calls
+// to DecodeBlockAt are safe and may be used to decode ranges of a stream in
+// parallel.
+type BlockReaderAt struct {
+	r              io.ReaderAt
+	index          BlockIndex
+	verifyChecksum bool
+}
+
+// NewBlockReaderAt returns a BlockReaderAt decoding blocks of the stream in r
+// located by index (see BuildBlockIndex).  The verifyChecksum param determines
+// whether block checksums are verified.
+func NewBlockReaderAt(r io.ReaderAt, index BlockIndex, verifyChecksum bool) *BlockReaderAt {
+	return &BlockReaderAt{
+		r:              r,
+		index:          index,
+		verifyChecksum: verifyChecksum,
+	}
+}
+
+// Index returns the block index used by b.
+func (b *BlockReaderAt) Index() BlockIndex {
+	return b.index
+}
+
+// DecodeBlockAt reads and decodes the data block whose chunk begins at offset
+// in the framed stream.  The offset must be that of a block in b's index.  A
+// newly allocated slice is returned for each call.
+func (b *BlockReaderAt) DecodeBlockAt(offset int64) ([]byte, error) {
+	if b.index.lookup(offset) < 0 {
+		return nil, fmt.Errorf("no block at offset %d", offset)
+	}
+
+	// the block is decoded by a Reader positioned at its chunk.  The section
+	// is large enough to hold a block of the maximum encoded length.
+	sr := io.NewSectionReader(b.r, offset, 4+int64(maxEncodedBlockSize)+4)
+	r := NewReader(sr, b.verifyChecksum)
+	r.implicitStreamID = true
+	p, err := r.ReadBlock(nil)
+	if cerr, ok := err.(*CorruptionError); ok {
+		cerr.Offset += offset
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.chunkOffset != 0 {
+		return nil, fmt.Errorf("no data block at offset %d", offset)
+	}
+	return p, nil
+}
+
+// NewSection returns an io.Reader that reads the decoded bytes in the range
+// [off, off+length) of the snappy framed stream stored in src and located by
+// index (see BuildBlockIndex), verifying block checksums.  Only the blocks
+// overlapping the range are read and decoded, which suits serving byte ranges
+// of a stream without decompressing all of it.  Like io.SectionReader, the
+// returned reader reports io.EOF early if the range extends beyond the end of
+// the stream.  If off or length is negative the returned reader fails with an
+// error.
+func NewSection(src io.ReaderAt, index BlockIndex, off, length int64) io.Reader {
+	if off < 0 || length < 0 {
+		return &section{err: fmt.Errorf("invalid section offset %d and length %d", off, length)}
+	}
+	end := off + length
+	if end < off {
+		end = math.MaxInt64 // overflow
+	}
+	i := sort.Search(len(index), func(i int) bool {
+		return index[i].DecodedOffset+int64(index[i].DecodedLen) > off
+	})
+	return &section{
+		br:  NewBlockReaderAt(src, index, VerifyChecksum),
+		i:   i,
+		pos: off,
+		end: end,
+	}
+}
+
+// section implements NewSection.
+type section struct {
+	br  *BlockReaderAt
+	i   int    // position in the index of the next block to decode
+	pos int64  // decoded offset of the next byte to read
+	end int64  // decoded offset of the end of the section
+	buf []byte // unread bytes of the current block within the section
+	err error  // returned by Read if the section is invalid
+}
+
+func (s *section) Read(b []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	if s.pos >= s.end {
+		return 0, io.EOF
+	}
+	for len(s.buf) == 0 {
+		if s.i >= len(s.br.index) {
+			return 0, io.EOF
+		}
+		entry := s.br.index[s.i]
+		p, err := s.br.DecodeBlockAt(entry.Offset)
+		if err != nil {
+			return 0, err
+		}
+		s.i++
+		// an index that does not describe the stream, such as a stale one,
+		// could otherwise place the section outside the block.
+		skip := s.pos - entry.DecodedOffset
+		if len(p) != entry.DecodedLen || skip < 0 || skip > int64(len(p)) {
+			s.err = &CorruptionError{
+				Offset: entry.Offset,
+				Err:    fmt.Errorf("block of %d bytes does not match index entry at decoded offset %d", len(p), entry.DecodedOffset),
+			}
+			return 0, s.err
+		}
+		if n := s.end - entry.DecodedOffset; n < int64(len(p)) {
+			p = p[:n]
+		}
+		s.buf = p[skip:]
+	}
+	n := copy(b, s.buf)
+	s.buf = s.buf[n:]
+	s.pos += int64(n)
+	return n, nil
+}
@@ -0,0 +1,177 @@
+package snappystream
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"sync"
+	"testing"
+)
+
+// This test checks that an index built for a stream locates each of its
+// blocks.
+func TestBuildBlockIndex(t *testing.T) {
+	stream := bytes.Join([][]byte{
+		streamID,
+		compressedChunk(t, bytes.Repeat([]byte("a"), 1000)),
+		opaqueChunk(0xfe, 10),
+		uncompressedChunk(t, []byte("raw")),
+		streamID,
+		compressedChunk(t, []byte("block")),
+	}, nil)
+
+	index, err := BuildBlockIndex(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatalf("index: %v", err)
+	}
+	chunk0 := int64(len(streamID))
+	chunk1 := chunk0 + int64(len(compressedChunk(t, bytes.Repeat([]byte("a"), 1000)))) + 14
+	chunk2 := chunk1 + int64(len(uncompressedChunk(t, []byte("raw")))) + int64(len(streamID))
+	want := BlockIndex{
+		{Offset: chunk0, DecodedOffset: 0, DecodedLen: 1000},
+		{Offset: chunk1, DecodedOffset: 1000, DecodedLen: 3},
+		{Offset: chunk2, DecodedOffset: 1003, DecodedLen: 5},
+	}
+	if len(index) != len(want) {
+		t.Fatalf("index %+v", index)
+	}
+	for i := range want {
+		if index[i] != want[i] {
+			t.Errorf("entry %d: %+v != %+v", i, index[i], want[i])
+		}
+	}
+}
+
+// This test checks that blocks can be decoded concurrently from an
+// io.ReaderAt.
+func TestBlockReaderAt(t *testing.T) {
+	p := bytes.Repeat(testDataMan, 20)
+	enc, err := encodeStreamBytes(p, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := BuildBlockIndex(bytes.NewReader(enc))
+	if err != nil {
+		t.Fatalf("index: %v", err)
+	}
+	if len(index) < 2 {
+		t.Fatalf("expected multiple blocks")
+	}
+
+	br := NewBlockReaderAt(bytes.NewReader(enc), index, VerifyChecksum)
+	var wg sync.WaitGroup
+	for _, e := range index {
+		wg.Add(1)
+		go func(e BlockEntry) {
+			defer wg.Done()
+			b, err := br.DecodeBlockAt(e.Offset)
+			if err != nil {
+				t.Errorf("decode at %d: %v", e.Offset, err)
+				return
+			}
+			if !bytes.Equal(b, p[e.DecodedOffset:e.DecodedOffset+int64(e.DecodedLen)]) {
+				t.Errorf("decode at %d: unequal decompressed content", e.Offset)
+			}
+		}(e)
+	}
+	wg.Wait()
+
+	_, err = br.DecodeBlockAt(index[0].Offset + 1)
+	if err == nil {
+		t.Fatalf("decode at unindexed offset: expected error")
+	}
+
+	// corruption errors report offsets within the full stream.
+	corrupt := append([]byte(nil), enc...)
+	corrupt[index[1].Offset+4] ^= 0xff
+	br = NewBlockReaderAt(bytes.NewReader(corrupt), index, VerifyChecksum)
+	_, err = br.DecodeBlockAt(index[1].Offset)
+	cerr, ok := err.(*CorruptionError)
+	if !ok || cerr.Offset != index[1].Offset {
+		t.Fatalf("decode corrupt block: %v", err)
+	}
+}
+
+// This test checks that a section delivers exactly the requested range of the
+// decoded stream.
+func TestNewSection(t *testing.T) {
+	p := bytes.Repeat(testDataMan, 50)
+	enc, err := encodeStreamBytes(p, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := BuildBlockIndex(bytes.NewReader(enc))
+	if err != nil {
+		t.Fatalf("index: %v", err)
+	}
+	if len(index) < 3 {
+		t.Fatalf("expected multiple blocks")
+	}
+
+	mid := index[1].DecodedOffset
+	for _, r := range [][2]int64{
+		{0, 0},
+		{0, 10},
+		{mid, 100},                        // start of a block
+		{mid - 10, 20},                    // spanning a block boundary
+		{5, index[2].DecodedOffset + 100}, // spanning several blocks
+		{int64(len(p)) - 10, 10},          // end of the stream
+		{int64(len(p)) - 10, 100},         // past the end of the stream
+		{0, int64(len(p))},                // the whole stream
+		{int64(len(p)), 10},               // empty at the end
+		{index[2].DecodedOffset - 1, MaxBlockSize + 2}, // partial first and last
+	} {
+		off, length := r[0], r[1]
+		b, err := ioutil.ReadAll(NewSection(bytes.NewReader(enc), index, off, length))
+		if err != nil {
+			t.Fatalf("section [%d, %d): %v", off, off+length, err)
+		}
+		end := off + length
+		if end > int64(len(p)) {
+			end = int64(len(p))
+		}
+		if !bytes.Equal(b, p[off:end]) {
+			t.Errorf("section [%d, %d): unequal content", off, off+length)
+		}
+	}
+	for _, r := range [][2]int64{{-1, 10}, {10, -1}} {
+		_, err := ioutil.ReadAll(NewSection(bytes.NewReader(enc), index, r[0], r[1]))
+		if err == nil {
+			t.Errorf("section at %d of length %d succeeded", r[0], r[1])
+		}
+	}
+	b, err := ioutil.ReadAll(NewSection(bytes.NewReader(enc), index, 10, math.MaxInt64))
+	if err != nil || !bytes.Equal(b, p[10:]) {
+		t.Errorf("section to end of stream: %v", err)
+	}
+}
+
+// This test checks that a section read with an index that does not describe
+// the stream reports corruption rather than panicking.
+func TestNewSectionMismatchedIndex(t *testing.T) {
+	enc, err := encodeStreamBytes(bytes.Repeat(testDataMan, 50), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := BuildBlockIndex(bytes.NewReader(enc))
+	if err != nil {
+		t.Fatalf("index: %v", err)
+	}
+
+	shifted := append(BlockIndex{}, index...)
+	shifted[1].DecodedOffset += 100 // leaves a gap before the block
+	short := append(BlockIndex{}, index...)
+	short[0].DecodedLen = 10
+	for _, test := range []struct {
+		index BlockIndex
+		off   int64
+	}{
+		{shifted, index[1].DecodedOffset + 10},
+		{short, 5},
+	} {
+		_, err := ioutil.ReadAll(NewSection(bytes.NewReader(enc), test.index, test.off, 100))
+		if _, ok := err.(*CorruptionError); !ok {
+			t.Errorf("section at %d: unexpected error %v", test.off, err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package snappystream
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// WithTotalLengthHeader causes a Writer to record n, the total length of the
+// data that will be written to the stream, in a skippable chunk following the
+// stream identifier.  A Reader created with VerifyTotalLength reports the
+// length with DecodedLength as soon as the first block has been read,
+// allowing the exact output buffer to be allocated, and checks that the
+// stream decodes to n bytes.  Close returns an *ExpectedLenError without
+// finishing the stream if a different amount of data was written.
+//
+// A Reader treats each stream identifier as the start of a new stream, so
+// WithTotalLengthHeader cannot be combined with WithResyncInterval; all
+// writes to such a Writer fail.
+func WithTotalLengthHeader(n int64) WriterOption {
+	return func(w *Writer) {
+		w.totalLength = n
+	}
+}
+
+// WithTotalLengthTrailer causes a Writer to record the total length of the
+// data written to the stream in a skippable chunk written by Close.  A Reader
+// created with VerifyTotalLength reports the length with DecodedLength once
+// it has reached the end of the stream.  Like WithTotalLengthHeader,
+// WithTotalLengthTrailer cannot be combined with WithResyncInterval.
+func WithTotalLengthTrailer() WriterOption {
+	return func(w *Writer) {
+		w.totalLengthTrailer = true
+	}
+}
+
+// writeTotalLength writes a chunk recording a total decoded length of n bytes
+// as an 8-byte little-endian value.
+func (w *Writer) writeTotalLength(n int64) error {
+	chunk := []byte{chunkTotalLength, 8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint64(chunk[4:], uint64(n))
+	return w.writeAll(chunk)
+}
+
+// VerifyTotalLength causes a Reader to read and verify the total lengths
+// recorded by Writers created with WithTotalLengthHeader or
+// WithTotalLengthTrailer.  A length recorded after a stream identifier is
+// compared with the data decoded before the next stream identifier or the end
+// of the stream, and a length recorded in a trailer with the data decoded
+// since the previous stream identifier or trailer, so concatenated and
+// appended streams are checked piece by piece.  A mismatch is reported as an
+// *ExpectedLenError and a negative length as corruption.  Chunks of the
+// same type that do not hold an 8-byte length are skipped, as are all such
+// chunks without this option, since other producers may use the chunk type
+// for their own purposes.
+func VerifyTotalLength() ReaderOption {
+	return func(r *Reader) {
+		r.verifyTotalLength = true
+	}
+}
+
+// DecodedLength returns the total decoded length recorded by a Writer created
+// with WithTotalLengthHeader or WithTotalLengthTrailer, and true, once r has
+// read the chunk recording it.  Lengths are only read by a Reader created with
+// VerifyTotalLength.  In a concatenated stream it is the length most
+// recently read.  It returns false if no such chunk has been read.
+func (r *Reader) DecodedLength() (int64, bool) {
+	return r.totalLength, r.hasTotalLength
+}
+
+// readTotalLength reads a chunk recording a total decoded length.  A length
+// recorded before any data of the current stream is verified at the end of
+// the stream, and a length recorded after data is compared with the data
+// decoded so far.
+func (r *Reader) readTotalLength() error {
+	buf, ok, err := r.readOptional(8)
+	if err != nil || !ok || len(buf) != 8 {
+		return err
+	}
+	n := int64(binary.LittleEndian.Uint64(buf))
+	if n < 0 {
+		return r.corrupt(fmt.Errorf("invalid total length %d", n))
+	}
+	r.totalLength = n
+	r.hasTotalLength = true
+
+	decoded := r.decoded - r.lengthStart
+	if decoded == 0 {
+		r.lengthExpected = n
+		return nil
+	}
+	if decoded != n {
+		return &ExpectedLenError{Expected: n, Decoded: decoded}
+	}
+	r.lengthStart = r.decoded
+	return nil
+}
+
+// checkTotalLength verifies the data decoded since the start of the current
+// stream against a length recorded at its start, if any, and begins a new
+// stream.  It is called at each stream identifier and at the end of input.
+func (r *Reader) checkTotalLength() error {
+	expected, decoded := r.lengthExpected, r.decoded-r.lengthStart
+	r.lengthStart = r.decoded
+	r.lengthExpected = -1
+	if expected >= 0 && decoded != expected {
+		return &ExpectedLenError{Expected: expected, Decoded: decoded}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package snappystream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// This test checks that the total length recorded in a header or trailer is
+// reported by a Reader and verified.
+func TestTotalLength(t *testing.T) {
+	p := bytes.Repeat(testDataMan, 10)
+	encode := func(opts ...WriterOption) []byte {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, opts...)
+		_, err := w.Write(p)
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		err = w.Close()
+		if err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	// the header is available after the first block.
+	header := encode(WithTotalLengthHeader(int64(len(p))))
+	r := NewReader(bytes.NewReader(header), true, VerifyTotalLength())
+	_, err := r.Read(make([]byte, 1))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if n, ok := r.DecodedLength(); !ok || n != int64(len(p)) {
+		t.Fatalf("header length %d, %v", n, ok)
+	}
+	b, err := DecodeAll(bytes.NewReader(header), true, 0)
+	if err != nil || !bytes.Equal(b, p) {
+		t.Fatalf("decode all: %v", err)
+	}
+	if cap(b) != len(p) {
+		t.Errorf("decoded into buffer of %d bytes", cap(b))
+	}
+
+	// the trailer is available at the end of the stream.
+	trailer := encode(WithTotalLengthTrailer())
+	r = NewReader(bytes.NewReader(trailer), true, VerifyTotalLength())
+	_, err = io.CopyN(ioutil.Discard, r, int64(len(p)))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if _, ok := r.DecodedLength(); ok {
+		t.Fatalf("trailer length before end of stream")
+	}
+	_, err = r.Read(make([]byte, 1))
+	if err != io.EOF {
+		t.Fatalf("read: %v", err)
+	}
+	if n, ok := r.DecodedLength(); !ok || n != int64(len(p)) {
+		t.Fatalf("trailer length %d, %v", n, ok)
+	}
+
+	// a recorded length disagreeing with the data is an error.
+	var ee *ExpectedLenError
+	w := NewWriter(ioutil.Discard, WithTotalLengthHeader(int64(len(p))+1))
+	_, err = w.Write(p)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err = w.Close(); !errors.As(err, &ee) {
+		t.Errorf("close with wrong length: %v", err)
+	}
+	bad := append(append([]byte{}, trailer[:len(trailer)-12]...), chunkTotalLength, 8, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0)
+	_, err = ioutil.ReadAll(NewReader(bytes.NewReader(bad), true, VerifyTotalLength()))
+	if !errors.As(err, &ee) {
+		t.Errorf("read with wrong trailer: %v", err)
+	}
+	badHeader := append([]byte{}, header...)
+	badHeader[len(streamID)+4]++
+	_, err = ioutil.ReadAll(NewReader(bytes.NewReader(badHeader), true, VerifyTotalLength()))
+	if !errors.As(err, &ee) {
+		t.Errorf("read with wrong header: %v", err)
+	}
+
+	// lengths are only read on request.
+	for _, stream := range [][]byte{bad, badHeader} {
+		r = NewReader(bytes.NewReader(stream), true)
+		b, err = ioutil.ReadAll(r)
+		if err != nil || !bytes.Equal(b, p) {
+			t.Errorf("read without verification: %v", err)
+		}
+		if _, ok := r.DecodedLength(); ok {
+			t.Errorf("length read without verification")
+		}
+	}
+}
+
+// This test checks that recorded lengths are verified separately for each
+// stream of a concatenated or appended stream, and that length chunks not
+// holding an 8-byte length are skipped.
+func TestTotalLengthConcatenated(t *testing.T) {
+	var buf bytes.Buffer
+	for _, test := range []struct {
+		w    *Writer
+		data string
+	}{
+		{NewWriter(&buf, WithTotalLengthTrailer()), "first"},
+		{NewAppender(&buf, WithTotalLengthTrailer()), "appended"},
+		{NewWriter(&buf, WithTotalLengthTrailer()), "second"},
+		{NewWriter(&buf, WithTotalLengthHeader(5)), "third"},
+		{NewWriter(&buf, WithTotalLengthHeader(6)), "fourth"},
+	} {
+		_, err := test.w.Write([]byte(test.data))
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		err = test.w.Close()
+		if err != nil {
+			t.Fatalf("close: %v", err)
+		}
+	}
+	b, err := ioutil.ReadAll(NewReader(&buf, true, VerifyTotalLength()))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(b) != "firstappendedsecondthirdfourth" {
+		t.Fatalf("decoded %q", b)
+	}
+
+	// chunks not holding an 8-byte length are skipped, however long.
+	for _, n := range []int{1, 100000} {
+		malformed := append(append([]byte{}, streamID...), chunkTotalLength, byte(n), byte(n>>8), byte(n>>16))
+		malformed = append(malformed, make([]byte, n)...)
+		malformed = append(malformed, uncompressedChunk(t, []byte("data"))...)
+		for _, opts := range [][]ReaderOption{nil, {VerifyTotalLength()}} {
+			b, err = ioutil.ReadAll(NewReader(bytes.NewReader(malformed), true, opts...))
+			if err != nil || string(b) != "data" {
+				t.Fatalf("read %q (%v)", b, err)
+			}
+		}
+	}
+}
+
+// This test checks that recording a total length is rejected in combination
+// with WithResyncInterval, whose repeated stream identifiers a Reader would
+// take for the start of new streams.
+func TestTotalLengthResyncInterval(t *testing.T) {
+	for _, opt := range []WriterOption{WithTotalLengthHeader(5), WithTotalLengthTrailer()} {
+		w := NewWriter(ioutil.Discard, opt, WithResyncInterval(50000))
+		_, err := w.Write([]byte("hello"))
+		if err == nil {
+			t.Fatalf("write succeeded")
+		}
+		if err = w.Close(); err == nil {
+			t.Fatalf("close succeeded")
+		}
+	}
+}
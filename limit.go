@@ -0,0 +1,100 @@
+package snappystream
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrTooLarge is returned from a reader created with LimitDecoded when the
+// decoded stream is larger than its limit.
+var ErrTooLarge = errors.New("decoded stream exceeds size limit")
+
+// LimitDecoded returns an io.Reader that reads decoded data from r (typically
+// a Reader) but returns ErrTooLarge once more than n decoded bytes would be
+// produced.  Exactly n bytes are delivered before the error is returned.
+// Unlike limiting the bytes buffered by a Reader, this is a hard cap on the
+// total decoded size of the stream and is useful when decoding untrusted
+// input.
+func LimitDecoded(r io.Reader, n int64) io.Reader {
+	return &limitedReader{r: r, n: n}
+}
+
+type limitedReader struct {
+	r   io.Reader
+	n   int64 // bytes remaining before the limit
+	err error
+}
+
+func (l *limitedReader) Read(b []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	if l.n <= 0 {
+		// probe for data beyond the limit to distinguish a stream that is
+		// exactly n bytes from one that is larger.
+		var p [1]byte
+		n, err := l.r.Read(p[:])
+		if n > 0 {
+			err = ErrTooLarge
+		}
+		if err != nil {
+			l.err = err
+		}
+		return 0, err
+	}
+
+	if int64(len(b)) > l.n {
+		b = b[:l.n]
+	}
+	n, err := l.r.Read(b)
+	l.n -= int64(n)
+	if err != nil {
+		l.err = err
+	}
+	return n, err
+}
+
+// ErrTruncated is reported by a Reader created with NewLimitedReader, wrapped
+// in a *CorruptionError, when its source ends before the length recorded by
+// the container has been read.
+var ErrTruncated = errors.New("stream truncated before recorded length")
+
+// NewLimitedReader returns a Reader that decodes a framed stream of exactly
+// compressedLen encoded bytes embedded in r, as when a container records the
+// length of each stream it holds.  The Reader returns io.EOF after consuming
+// compressedLen bytes and reads no further, leaving r positioned at the end of
+// the embedded stream.  If r ends before compressedLen bytes have been read the
+// Reader reports ErrTruncated, even if the stream ended at a chunk boundary.
+func NewLimitedReader(r io.Reader, compressedLen int64, verifyChecksum bool, opts ...ReaderOption) *Reader {
+	src := &sectionSource{r: r, n: compressedLen}
+	_r := NewReader(src, verifyChecksum, opts...)
+	src.zr = _r
+	return _r
+}
+
+// sectionSource reads at most n bytes from r, reporting an early end of r as
+// corruption of the stream decoded by zr.
+type sectionSource struct {
+	r  io.Reader
+	n  int64 // bytes remaining in the section
+	zr *Reader
+}
+
+func (s *sectionSource) Read(b []byte) (int, error) {
+	if s.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(b)) > s.n {
+		b = b[:s.n]
+	}
+	n, err := s.r.Read(b)
+	s.n -= int64(n)
+	if err == io.EOF && s.n > 0 {
+		err = s.zr.corrupt(ErrTruncated)
+	}
+	return n, err
+}
@@ -0,0 +1,81 @@
+package snappystream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// This test checks that LimitDecoded errors precisely at its limit.
+func TestLimitDecoded(t *testing.T) {
+	p := bytes.Repeat([]byte("limit "), 50000)
+	enc, err := encodeStreamBytes(p, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a stream of exactly n bytes is read successfully.
+	b, err := ioutil.ReadAll(LimitDecoded(NewReader(bytes.NewReader(enc), true), int64(len(p))))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(b, p) {
+		t.Fatalf("unequal decompressed content")
+	}
+
+	for _, n := range []int64{0, 1, MaxBlockSize - 1, MaxBlockSize, MaxBlockSize + 1, int64(len(p)) - 1} {
+		b, err = ioutil.ReadAll(LimitDecoded(NewReader(bytes.NewReader(enc), true), n))
+		if err != ErrTooLarge {
+			t.Errorf("limit %d: unexpected error %v", n, err)
+		}
+		if int64(len(b)) != n {
+			t.Errorf("limit %d: read %d bytes", n, len(b))
+		}
+		if !bytes.Equal(b, p[:len(b)]) {
+			t.Errorf("limit %d: unequal decompressed content", n)
+		}
+	}
+
+	// errors from the underlying reader are passed through.
+	_, err = io.Copy(ioutil.Discard, LimitDecoded(NewReader(bytes.NewReader(enc[:len(enc)-1]), true), int64(len(p))))
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("truncated: %v", err)
+	}
+}
+
+// This test checks that streams stored back to back with their lengths can be
+// decoded with NewLimitedReader and that truncation is reported as corruption.
+func TestNewLimitedReader(t *testing.T) {
+	first, err := encodeStreamBytes([]byte("first stream"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := encodeStreamBytes(bytes.Repeat([]byte("second "), 10000), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := bytes.NewReader(append(append([]byte{}, first...), second...))
+
+	b, err := ioutil.ReadAll(NewLimitedReader(src, int64(len(first)), true))
+	if err != nil || string(b) != "first stream" {
+		t.Fatalf("read first %q (%v)", b, err)
+	}
+	if src.Len() != len(second) {
+		t.Fatalf("source left with %d bytes", src.Len())
+	}
+	b, err = ioutil.ReadAll(NewLimitedReader(src, int64(len(second)), true))
+	if err != nil || !bytes.Equal(b, bytes.Repeat([]byte("second "), 10000)) {
+		t.Fatalf("read second (%v)", err)
+	}
+
+	// the source ends inside a chunk and at a chunk boundary.
+	for _, n := range []int{len(first) - 1, len(streamID)} {
+		r := NewLimitedReader(bytes.NewReader(first[:n]), int64(len(first)), true)
+		_, err = ioutil.ReadAll(r)
+		if !errors.Is(err, ErrTruncated) {
+			t.Errorf("truncated at %d: unexpected error %v", n, err)
+		}
+	}
+}
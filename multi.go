@@ -0,0 +1,92 @@
+package snappystream
+
+import (
+	"io"
+)
+
+// MultiWriter is an io.WriteCloser that encodes its input as a snappy framed
+// stream, like a Writer, and writes the identical framed bytes to several
+// destinations.  Each block is compressed once regardless of the number of
+// destinations.
+//
+// By default a MultiWriter fails fast: an error writing to any destination is
+// returned and all future writes fail.  See ContinueOnError.
+type MultiWriter struct {
+	w *Writer
+	d *multiDest
+}
+
+// NewMultiWriter returns a MultiWriter that writes a snappy framed stream to
+// each of ws.
+func NewMultiWriter(ws ...io.Writer) *MultiWriter {
+	d := &multiDest{
+		ws:   ws,
+		errs: make([]error, len(ws)),
+	}
+	return &MultiWriter{
+		w: NewWriter(d),
+		d: d,
+	}
+}
+
+// ContinueOnError controls whether m continues writing to the remaining
+// destinations after a destination fails.  If ok is true a failed destination
+// is dropped, its error is retained (see Errors), and writes to m fail only
+// once every destination has failed.  ContinueOnError must be called before
+// data is written to m.
+func (m *MultiWriter) ContinueOnError(ok bool) {
+	m.d.continueOnError = ok
+}
+
+// Errors returns the error that caused each destination to be dropped, in the
+// order the destinations were given to NewMultiWriter.  The error for a
+// destination that has not failed is nil.
+func (m *MultiWriter) Errors() []error {
+	return m.d.errs
+}
+
+// Write encodes p and writes it to all destinations.  See Writer.Write.
+func (m *MultiWriter) Write(p []byte) (int, error) {
+	return m.w.Write(p)
+}
+
+// Close finalizes the stream written to all destinations.  See Writer.Close.
+// The destinations are not closed.
+func (m *MultiWriter) Close() error {
+	return m.w.Close()
+}
+
+// multiDest is the io.Writer receiving the framed stream of a MultiWriter.
+type multiDest struct {
+	ws              []io.Writer
+	errs            []error // errors of failed destinations
+	continueOnError bool
+}
+
+func (d *multiDest) Write(p []byte) (int, error) {
+	var err error
+	live := 0
+	for i, w := range d.ws {
+		if d.errs[i] != nil {
+			err = d.errs[i]
+			continue
+		}
+		n, werr := w.Write(p)
+		if werr == nil && n != len(p) {
+			werr = io.ErrShortWrite
+		}
+		if werr != nil {
+			d.errs[i] = werr
+			if !d.continueOnError {
+				return 0, werr
+			}
+			err = werr
+			continue
+		}
+		live++
+	}
+	if live == 0 && err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
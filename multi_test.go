@@ -0,0 +1,69 @@
+package snappystream
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+// This test checks that all destinations of a MultiWriter receive identical
+// streams.
+func TestMultiWriter(t *testing.T) {
+	var buf1, buf2 bytes.Buffer
+	w := NewMultiWriter(&buf1, &buf2)
+	data := bytes.Repeat([]byte("replicated "), 10000)
+	_, err := w.Write(data)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if !bytes.Equal(buf1.Bytes(), buf2.Bytes()) {
+		t.Fatalf("destinations received different streams")
+	}
+	b, err := ioutil.ReadAll(NewReader(&buf1, true))
+	if err != nil || !bytes.Equal(b, data) {
+		t.Fatalf("read: %v", err)
+	}
+}
+
+// This test checks the handling of destination errors by a MultiWriter.
+func TestMultiWriterError(t *testing.T) {
+	errFail := errors.New("failed")
+
+	var buf bytes.Buffer
+	w := NewMultiWriter(&buf, unwritable(errFail))
+	_, err := w.Write([]byte("fail fast"))
+	if !errors.Is(err, errFail) {
+		t.Fatalf("write: %v", err)
+	}
+
+	buf.Reset()
+	w = NewMultiWriter(unwritable(errFail), &buf)
+	w.ContinueOnError(true)
+	_, err = w.Write([]byte("continue"))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if errs := w.Errors(); errs[0] != errFail || errs[1] != nil {
+		t.Fatalf("errors: %v", errs)
+	}
+	b, err := ioutil.ReadAll(NewReader(&buf, true))
+	if err != nil || string(b) != "continue" {
+		t.Fatalf("read %q (%v)", b, err)
+	}
+
+	w = NewMultiWriter(unwritable(errFail), unwritable(errFail))
+	w.ContinueOnError(true)
+	_, err = w.Write([]byte("all failed"))
+	if !errors.Is(err, errFail) {
+		t.Fatalf("write: %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package snappystream
+
+import (
+	"io"
+)
+
+// NewRawWriter returns a Writer that emits framed blocks, with the same
+// headers and checksums as a Writer returned by NewWriter, but never writes
+// the stream identifier.  This "raw frames" mode interoperates with
+// implementations that exchange framed blocks without the identifier; its
+// output is not a valid snappy framed stream and is read with NewRawReader.
+// WithAppHeader and WithResyncInterval, which rely on the stream identifier,
+// have no effect on the returned Writer.
+func NewRawWriter(w io.Writer, opts ...WriterOption) *Writer {
+	_w := NewWriter(w, opts...)
+	_w.sentStreamID = true
+	_w.resyncInterval = 0
+	return _w
+}
+
+// NewRawReader returns a Reader that decodes the raw frames written by a
+// Writer returned from NewRawWriter.  The stream need not begin with a stream
+// identifier but the framing and checksums of its blocks are otherwise
+// validated as by NewReader.  Any stream identifiers that do appear are
+// skipped.
+func NewRawReader(r io.Reader, verifyChecksum bool, opts ...ReaderOption) *Reader {
+	_r := NewReader(r, verifyChecksum, opts...)
+	_r.rawFrames = true
+	_r.implicitStreamID = true
+	return _r
+}
@@ -0,0 +1,55 @@
+package snappystream
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+// This test checks that raw frames round trip without a stream identifier.
+func TestRawFrames(t *testing.T) {
+	p := bytes.Repeat(testDataMan, 10)
+	var buf bytes.Buffer
+	w := NewRawWriter(&buf, WithResyncInterval(1), WithStreamChecksum())
+	_, err := w.Write(p)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	enc := buf.Bytes()
+	if bytes.Contains(enc, streamID) {
+		t.Fatalf("raw frames contain the stream identifier")
+	}
+
+	r := NewRawReader(bytes.NewReader(enc), true, VerifyStreamChecksum())
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(b, p) {
+		t.Fatalf("unequal decompressed content")
+	}
+
+	// the mode survives Reset.
+	r.Reset(bytes.NewReader(enc))
+	b, err = ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(b, p) {
+		t.Fatalf("read after reset: %v", err)
+	}
+
+	// a standard Reader rejects raw frames.
+	_, err = ioutil.ReadAll(NewReader(bytes.NewReader(enc), true))
+	if err == nil {
+		t.Fatalf("raw frames read as a framed stream")
+	}
+
+	// an empty raw stream is empty.
+	buf.Reset()
+	err = NewRawWriter(&buf).Close()
+	if err != nil || buf.Len() != 0 {
+		t.Fatalf("closed empty raw writer %x (%v)", buf.Bytes(), err)
+	}
+}
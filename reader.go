@@ -2,10 +2,14 @@ package snappystream
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash"
 	"hash/crc32"
 	"io"
 	"io/ioutil"
+	"time"
 
 	"github.com/mreiferson/go-snappystream/snappy-go"
 )
@@ -15,7 +19,396 @@ import (
 // signifies that the source byte stream is not snappy framed.
 var errMissingStreamID = fmt.Errorf("missing stream identifier")
 
-type reader struct {
+// ErrLooksLikeRawSnappy is reported by a Reader, wrapped in a
+// *CorruptionError, in place of a missing stream identifier when the stream
+// appears to begin with a raw snappy block, such as the output of
+// snappy.Encode, rather than a snappy framed stream.  The detection is a
+// heuristic.
+var ErrLooksLikeRawSnappy = errors.New("missing stream identifier: input looks like a raw snappy block, decode it with snappy.Decode")
+
+// ErrNotSnappy is returned from NewUnframedReader when the source neither
+// begins with a stream identifier nor with a plausible raw snappy block.
+var ErrNotSnappy = errors.New("input is neither a snappy framed stream nor raw snappy blocks")
+
+// rawSnappyPrefix is the length of the prefix of a stream missing its stream
+// identifier that is checked for a raw snappy block.
+const rawSnappyPrefix = 4096
+
+// looksLikeRawSnappy reports whether p could be a raw snappy block, or its
+// prefix if complete is false, by checking that its elements are well formed.
+func looksLikeRawSnappy(p []byte, complete bool) bool {
+	declen, n := binary.Uvarint(p)
+	if n <= 0 || declen == 0 {
+		return false
+	}
+	var d uint64 // bytes decoded by the elements so far
+	for s := n; s < len(p); {
+		tag, h := p[s], rawHeaderLen(p[s])
+		if s+h > len(p) {
+			return !complete
+		}
+		length, offset := parseRawElement(p[s : s+h])
+		s += h
+		if tag&0x03 == tagLiteral {
+			s += int(length)
+			d += length
+			if s > len(p) {
+				return !complete && d <= declen
+			}
+			if d > declen {
+				return false
+			}
+			continue
+		}
+		if offset == 0 || offset > d || d+length > declen {
+			return false
+		}
+		d += length
+	}
+	return !complete || d == declen
+}
+
+// checkRawSnappy reads a prefix of the stream, whose first chunk header is in
+// r.hdr, and reports whether it looks like a raw snappy block.  It is used
+// only to diagnose a stream missing its stream identifier.
+func (r *Reader) checkRawSnappy() bool {
+	p := make([]byte, len(r.hdr)+rawSnappyPrefix)
+	copy(p, r.hdr)
+	n, err := io.ReadFull(r.reader, p[len(r.hdr):])
+	complete := err == io.EOF || err == io.ErrUnexpectedEOF
+	if err != nil && !complete {
+		return false
+	}
+	return looksLikeRawSnappy(p[:len(r.hdr)+n], complete)
+}
+
+// ExpectedLenError is returned from a Reader created with
+// NewReaderExpectedLen when the decoded length of the stream disagrees with the
+// length recorded by its container.
+type ExpectedLenError struct {
+	Expected int64 // decoded length recorded by the container
+	Decoded  int64 // decoded length observed in the stream
+}
+
+func (e *ExpectedLenError) Error() string {
+	if e.Decoded > e.Expected {
+		return fmt.Sprintf("decoded length exceeds expected length %d > %d", e.Decoded, e.Expected)
+	}
+	return fmt.Sprintf("decoded length short of expected length %d < %d", e.Decoded, e.Expected)
+}
+
+// Reset discards r's state and prepares it to decode the stream read from
+// src, as if newly created with the same arguments and options.  Internal
+// buffers are retained, allowing Readers to be pooled.  A length given to
+// NewReaderExpectedLen is not retained.
+func (r *Reader) Reset(src io.Reader) {
+	r.ResetSize(src, 0)
+}
+
+// ResetSize is like Reset but right-sizes r's block buffers for streams
+// whose blocks hold around sizeHint bytes, as with NewReaderSize.  Existing
+// buffers are kept if they are large enough and are otherwise reallocated.
+// A non-positive sizeHint keeps the existing buffers.
+func (r *Reader) ResetSize(src io.Reader, sizeHint int) {
+	if sizeHint > 0 {
+		n := sizeHint
+		if n < 4096 {
+			n = 4096
+		}
+		if n > MaxBlockSize {
+			n = MaxBlockSize
+		}
+		if cap(r.src) < n {
+			r.src = make([]byte, n)
+		}
+		if cap(r.dst) < n {
+			r.dst = make([]byte, n)
+		}
+	}
+	if r.streamDigest != nil {
+		r.streamDigest.Reset()
+	}
+
+	var setDeadline func() error
+	if r.readTimeout > 0 {
+		setDeadline = deadlineSetter(src, r.readTimeout)
+	}
+
+	r.buf.Reset()
+	*r = Reader{
+		reader: &progressReader{r: src},
+
+		verifyChecksum:       r.verifyChecksum,
+		codec:                r.codec,
+		crcTable:             r.crcTable,
+		checksumMask:         r.checksumMask,
+		diagnoseChecksum:     r.diagnoseChecksum,
+		accumulateChecksums:  r.accumulateChecksums,
+		lenientStreamID:      r.lenientStreamID,
+		singleStream:         r.singleStream,
+		trailerMode:          r.trailerMode,
+		rawFrames:            r.rawFrames,
+		nonBlockingRead:      r.nonBlockingRead,
+		implicitStreamID:     r.rawFrames,
+		expectedLen:          -1,
+		lengthExpected:       -1,
+		verifyTotalLength:    r.verifyTotalLength,
+		strictEOF:            r.strictEOF,
+		maxBlockSize:         r.maxBlockSize,
+		onFrame:              r.onFrame,
+		unknownChunk:         r.unknownChunk,
+		maxEncodedLen:        r.maxEncodedLen,
+		maxSkips:             r.maxSkips,
+		verifyStreamChecksum: r.verifyStreamChecksum,
+		streamDigest:         r.streamDigest,
+		readTimeout:          r.readTimeout,
+		setDeadline:          setDeadline,
+
+		buf: r.buf,
+		hdr: r.hdr,
+		src: r.src[:cap(r.src)],
+		dst: r.dst[:cap(r.dst)],
+	}
+}
+
+// ErrNoBlock is returned from VerifyLast when no data block has been decoded.
+var ErrNoBlock = errors.New("no block decoded")
+
+// ErrBlockTooLarge matches, using errors.Is, any *BlockTooLargeError.
+var ErrBlockTooLarge = errors.New("block too large")
+
+// BlockTooLargeError is reported by a Reader, wrapped in a *CorruptionError,
+// when the length of a block exceeds the limit imposed by the framing format.
+// Length is the encoded length declared by the chunk header unless Decoded is
+// true, in which case it is the decoded length of the block data.
+type BlockTooLargeError struct {
+	Length  int64 // length of the block
+	Limit   int64 // largest length allowed
+	Decoded bool  // Length and Limit refer to decoded data
+}
+
+func (e *BlockTooLargeError) Error() string {
+	if e.Decoded {
+		return fmt.Sprintf("decoded block data too large %d > %d", e.Length, e.Limit)
+	}
+	return fmt.Sprintf("encoded block data too large %d > %d", e.Length, e.Limit)
+}
+
+// Is reports whether target is ErrBlockTooLarge.
+func (e *BlockTooLargeError) Is(target error) bool {
+	return target == ErrBlockTooLarge
+}
+
+// ErrInvalidStreamID matches, using errors.Is, any *InvalidStreamIDError.
+var ErrInvalidStreamID = errors.New("invalid stream identifier")
+
+// InvalidStreamIDError is reported by a Reader, wrapped in a
+// *CorruptionError, when a chunk of the stream identifier type is malformed.
+// If Header is true the chunk header declared the wrong length and Bytes holds
+// the header.  Otherwise Bytes holds the chunk data read in place of "sNaPpY".
+// A stream that is not snappy framed but happens to begin with 0xff is
+// typically reported this way.
+type InvalidStreamIDError struct {
+	Header bool   // the chunk header was invalid, rather than its data
+	Bytes  []byte // the invalid header or data
+}
+
+func (e *InvalidStreamIDError) Error() string {
+	if e.Header {
+		return fmt.Sprintf("invalid stream identifier header %x", e.Bytes)
+	}
+	return fmt.Sprintf("invalid stream identifier block %q", e.Bytes)
+}
+
+// Is reports whether target is ErrInvalidStreamID.
+func (e *InvalidStreamIDError) Is(target error) bool {
+	return target == ErrInvalidStreamID
+}
+
+// ReaderOption configures optional behavior of a Reader.
+type ReaderOption func(*Reader)
+
+// VerifyStreamChecksum causes a Reader to verify the stream checksum trailer
+// emitted by a Writer created with WithStreamChecksum.  A *CorruptionError
+// wrapping ErrStreamChecksum is returned if the trailer does not match the
+// decoded content and io.ErrUnexpectedEOF is returned if the stream ends
+// without a trailer.  Each trailer covers the data decoded since the previous
+// trailer, so that concatenated and appended streams, each with its own
+// trailer, are verified piece by piece.
+func VerifyStreamChecksum() ReaderOption {
+	return func(r *Reader) {
+		r.verifyStreamChecksum = true
+	}
+}
+
+// NonBlockingRead changes how a Reader's Read method fills a buffer larger
+// than the decoded data it has buffered.  By default Read decodes the next
+// block before returning, which may block reading from the source, and
+// returns as much of the buffered and newly decoded data as fits.  With this
+// option Read returns the buffered data immediately, decoding the next block
+// only when no decoded data is buffered.  Reads then return fewer bytes, as
+// io.Reader permits, but latency-sensitive consumers receive data as soon as
+// it has been decoded.
+func NonBlockingRead() ReaderOption {
+	return func(r *Reader) {
+		r.nonBlockingRead = true
+	}
+}
+
+// OnFrame causes a Reader to call fn after each data block is successfully
+// decoded with the number of bytes consumed from the source stream and the
+// total number of decoded bytes so far, for example to report progress.  fn is
+// called synchronously from the goroutine reading from the Reader, before the
+// block's data is delivered, and should return quickly.
+func OnFrame(fn func(compressedOffset, decodedTotal int64)) ReaderOption {
+	return func(r *Reader) {
+		r.onFrame = fn
+	}
+}
+
+// UnknownChunkHandler causes a Reader to consult fn when it encounters a
+// reserved unskippable chunk (types 0x02-0x7f), which would otherwise be
+// reported as corruption, allowing chunks defined by later versions of the
+// format to be ignored where that is known to be safe.  fn is called with the
+// chunk's type and contents.  If fn returns an error the Reader fails with
+// it; otherwise the chunk is skipped and decoding continues if skip is true,
+// and the Reader fails with the usual corruption error if not.  body is only
+// valid for the duration of the call.  Chunks larger than the largest encoded
+// data block are not buffered and fn is called with a nil body.
+func UnknownChunkHandler(fn func(typ byte, body []byte) (skip bool, err error)) ReaderOption {
+	return func(r *Reader) {
+		r.unknownChunk = fn
+	}
+}
+
+// MaxOversizeBlockSize is the largest decoded block size that may be allowed
+// with AllowOversizeBlocks.
+const MaxOversizeBlockSize = 1 << 22
+
+// AllowOversizeBlocks causes a Reader to accept data blocks that decode to as
+// many as maxBytes bytes, rather than the MaxBlockSize allowed by the framing
+// format, with correspondingly larger encoded blocks.  maxBytes is clamped to
+// the range [MaxBlockSize, MaxOversizeBlockSize].
+//
+// Such blocks are not standard.  This option exists only to rescue data from
+// nonconformant encoders and should not be used to read streams in general.
+func AllowOversizeBlocks(maxBytes int) ReaderOption {
+	if maxBytes < MaxBlockSize {
+		maxBytes = MaxBlockSize
+	}
+	if maxBytes > MaxOversizeBlockSize {
+		maxBytes = MaxOversizeBlockSize
+	}
+	return func(r *Reader) {
+		r.maxBlockSize = maxBytes
+		r.maxEncodedLen = uint32(snappy.MaxEncodedLen(maxBytes))
+	}
+}
+
+// StrictEOF causes a Reader to require that the stream end cleanly.  When the
+// wrapped io.Reader reaches EOF before a stream identifier has been read, or
+// before the length given to NewReaderExpectedLen has been decoded, the Reader
+// returns io.ErrUnexpectedEOF instead of io.EOF.  A stream truncated inside a
+// frame (including a partial frame header) is always reported as
+// io.ErrUnexpectedEOF, regardless of this option.
+func StrictEOF() ReaderOption {
+	return func(r *Reader) {
+		r.strictEOF = true
+	}
+}
+
+// CorruptionError is returned from a Reader when its source stream is
+// malformed or corrupt.  It records the offset in the source stream of the
+// chunk in which the problem was detected.
+type CorruptionError struct {
+	Offset int64 // offset of the chunk in the source stream
+	Err    error // the underlying problem
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("%v (chunk at offset %d)", e.Err, e.Offset)
+}
+
+// Unwrap returns the underlying problem.
+func (e *CorruptionError) Unwrap() error {
+	return e.Err
+}
+
+// DefaultMaxConsecutiveSkips is the number of consecutive non-data chunks a
+// Reader skips before reporting ErrTooManySkips, unless configured otherwise
+// with MaxConsecutiveSkips.
+const DefaultMaxConsecutiveSkips = 1024
+
+// ErrTooManySkips is reported by a Reader, wrapped in a *CorruptionError, when
+// a stream contains more consecutive non-data chunks than allowed by
+// MaxConsecutiveSkips.
+var ErrTooManySkips = errors.New("too many consecutive non-data chunks")
+
+// MaxConsecutiveSkips limits the number of padding and skippable chunks that
+// a Reader skips without decoding data before returning ErrTooManySkips.
+// Empty data blocks do not end a run of skipped chunks; stream identifiers
+// are not counted.  This bounds the work a hostile stream can force without
+// delivering data.  If n is not positive no limit is
+// imposed.  The default limit is DefaultMaxConsecutiveSkips.
+func MaxConsecutiveSkips(n int) ReaderOption {
+	return func(r *Reader) {
+		r.maxSkips = n
+	}
+}
+
+// LazyChecksum causes a Reader to skip verifying block checksums while
+// decoding, regardless of the verifyChecksum argument given to its
+// constructor.  The checksum of the most recently decoded block is retained so
+// that it can be verified on demand with VerifyLast, allowing integrity to be
+// spot checked on a sample of blocks.
+func LazyChecksum() ReaderOption {
+	return func(r *Reader) {
+		r.verifyChecksum = false
+	}
+}
+
+// ErrChecksumOverCompressed is reported by a Reader created with
+// DiagnoseChecksum, wrapped in a *CorruptionError, when the checksum of a
+// compressed block matches its compressed data instead of its decoded data.
+var ErrChecksumOverCompressed = errors.New("checksum computed over compressed data, not decoded")
+
+// DiagnoseChecksum causes a Reader that finds a compressed block whose
+// checksum does not match its decoded data to also compare the checksum
+// against the compressed data.  If that matches, ErrChecksumOverCompressed is
+// reported, pinpointing a producer that checksums the wrong data.  The
+// option is a debugging aid and does not make such streams readable.
+func DiagnoseChecksum() ReaderOption {
+	return func(r *Reader) {
+		r.diagnoseChecksum = true
+	}
+}
+
+// AccumulateChecksums causes a Reader to check block checksums as blocks are
+// decoded without failing reads on a mismatch, regardless of the
+// verifyChecksum argument given to its constructor.  Instead the first
+// mismatch is retained and reported by VerifyAccumulated, typically once the
+// stream has been read to the end.
+func AccumulateChecksums() ReaderOption {
+	return func(r *Reader) {
+		r.verifyChecksum = false
+		r.accumulateChecksums = true
+	}
+}
+
+// LenientStreamID causes a Reader to accept streams that, against the
+// specification, omit the leading stream identifier.  If the first chunk of the
+// stream is a data block it is decoded as though a stream identifier preceded
+// it.  By default such streams are rejected.
+func LenientStreamID() ReaderOption {
+	return func(r *Reader) {
+		r.lenientStreamID = true
+	}
+}
+
+// Reader is an io.Reader that decodes a snappy framed stream.  Reader cannot
+// be instantiated via struct literal and must use NewReader or one of its
+// variants.
+type Reader struct {
 	reader io.Reader
 
 	err error
@@ -23,13 +416,99 @@ type reader struct {
 	seenStreamID   bool
 	verifyChecksum bool
 
-	buf bytes.Buffer
+	codec Codec
+
+	crcTable     *crc32.Table // see ReaderCRCTable
+	checksumMask uint32       // see ReaderChecksumMask
+
+	hasLast      bool   // a block has been decoded
+	lastBlock    []byte // decoded data of the most recent block
+	lastChecksum uint32 // unmasked checksum of the most recent block
+	lastOffset   int64  // offset of the most recent block
+	lastEncoded  []byte // compressed data of the most recent block, if any
+
+	lastCompressed bool // the most recent block was compressed
+
+	diagnoseChecksum bool
+
+	accumulateChecksums bool
+	accumulatedErr      error // first checksum mismatch when accumulating
+
+	discard bool // compressed blocks need not be decoded (see Drain)
+
+	rawFrames bool // see NewRawReader
+
+	nonBlockingRead bool // see NonBlockingRead
+
+	setDeadline func() error  // called before reading each chunk, if non-nil
+	readTimeout time.Duration // see NewDeadlineReader, 0 if none
+
+	spare []byte // buffer for ReadMessage, see PutBlock
+
+	onFrame func(compressedOffset, decodedTotal int64) // see OnFrame
+
+	unknownChunk func(typ byte, body []byte) (bool, error) // see UnknownChunkHandler
+
+	lenientStreamID  bool
+	implicitStreamID bool // a data block began the stream in lenient mode
+
+	singleStream  bool // stop at the next stream identifier (see Multistream)
+	memberEnd     bool // stopped at a member boundary
+	pendingHeader bool // r.hdr holds the stream identifier of the next member
+	trailerMode   TrailerMode
+	trailer       []byte // data following the stream (see Trailer)
+
+	offset      int64 // bytes consumed from reader
+	chunkOffset int64 // offset of the current chunk
+
+	expectedLen int64 // -1 if unknown
+	decoded     int64 // total bytes decoded from data blocks
+
+	strictEOF bool
+	atEOF     bool // reader ended cleanly at a chunk boundary
+
+	seenTerminal bool // a terminal marker was read
+
+	maxBlockSize  int    // largest decoded block, see AllowOversizeBlocks
+	maxEncodedLen uint32 // largest encoded block, excluding its checksum
+
+	maxSkips int // 0 if unlimited
+	skips    int // consecutive non-data chunks
+
+	paddingChunks   int64
+	skippableChunks int64 // excluding padding
+	dataBlocks      int64
+
+	maxDecodedBlock int // largest decoded block length
+
+	totalLength       int64 // see DecodedLength
+	hasTotalLength    bool
+	verifyTotalLength bool  // see VerifyTotalLength
+	lengthStart       int64 // decoded offset covered by the next recorded length
+	lengthExpected    int64 // length recorded at lengthStart, -1 if none
+
+	appHeader []byte // nil until an app header chunk is read
+
+	version    byte // see Version
+	hasVersion bool
+
+	verifyStreamChecksum bool
+	seenStreamChecksum   bool
+	streamCRC            uint32 // crc32c of all decoded data
+
+	streamDigest     hash.Hash // digest of all decoded data, if verifying
+	seenStreamDigest bool
+
+	sidecarLen int  // decoded length recorded by a block length sidecar
+	hasSidecar bool // sidecarLen applies to the next block (see ScanBlockIndex)
+
+	buf *bytes.Buffer // decoded data not yet returned by Read
 	hdr []byte
 	src []byte
 	dst []byte
 }
 
-// NewReader returns an io.Reader interface to the snappy framed stream format.
+// NewReader returns a Reader that decodes the snappy framed stream format.
 //
 // It transparently handles reading the stream identifier (but does not proxy this
 // to the caller), decompresses blocks, and (optionally) validates checksums.
@@ -45,26 +524,417 @@ type reader struct {
 // For each Read, the returned length will be up to the lesser of len(b) or 65536
 // decompressed bytes, regardless of the length of *compressed* bytes read
 // from the wrapped io.Reader.
-func NewReader(r io.Reader, verifyChecksum bool) io.Reader {
-	return &reader{
-		reader: r,
+//
+// The options opts configure optional behavior of the returned Reader.
+func NewReader(r io.Reader, verifyChecksum bool, opts ...ReaderOption) *Reader {
+	return newReader(r, verifyChecksum, 4096, opts)
+}
+
+// newReader allocates a Reader with block buffers of n bytes.
+func newReader(r io.Reader, verifyChecksum bool, n int, opts []ReaderOption) *Reader {
+	_r := &Reader{
+		reader: &progressReader{r: r},
 
 		verifyChecksum: verifyChecksum,
+		codec:          DefaultCodec,
+		crcTable:       crcTable,
+		checksumMask:   DefaultChecksumMask,
+		expectedLen:    -1,
+		lengthExpected: -1,
+		maxSkips:       DefaultMaxConsecutiveSkips,
+		maxBlockSize:   MaxBlockSize,
+		maxEncodedLen:  maxEncodedBlockSize,
 
+		buf: &bytes.Buffer{},
 		hdr: make([]byte, 4),
-		src: make([]byte, 4096),
-		dst: make([]byte, 4096),
+		src: make([]byte, n),
+		dst: make([]byte, n),
+	}
+	for _, opt := range opts {
+		opt(_r)
 	}
+	return _r
+}
+
+// NewReaderSize is like NewReader but pre-allocates its internal buffers
+// according to bufSize.  The buffers holding encoded and decoded block data are
+// allocated with bufSize bytes, clamped to the range [4096, MaxBlockSize], and
+// the buffer of unread decoded bytes is grown to bufSize bytes.
+//
+// NewReaderSize is a tuning knob only.  Buffers are grown automatically as
+// needed and the choice of bufSize does not affect correctness.
+func NewReaderSize(r io.Reader, verifyChecksum bool, bufSize int, opts ...ReaderOption) *Reader {
+	n := bufSize
+	if n < 4096 {
+		n = 4096
+	}
+	if n > MaxBlockSize {
+		n = MaxBlockSize
+	}
+	_r := newReader(r, verifyChecksum, n, opts)
+	if bufSize > 0 {
+		_r.buf.Grow(bufSize)
+	}
+	return _r
+}
+
+// NewReaderExpectedLen is like NewReader but is given the total decoded length
+// of the stream, as recorded by a container the stream is embedded in.  The
+// length is used as a hint to pre-size destination buffers in WriteTo and to
+// validate the stream.  If the stream decodes to more than decodedLen bytes,
+// or ends before decodedLen bytes have been decoded, an *ExpectedLenError is
+// returned.
+func NewReaderExpectedLen(r io.Reader, verifyChecksum bool, decodedLen int64, opts ...ReaderOption) *Reader {
+	_r := NewReader(r, verifyChecksum, opts...)
+	_r.expectedLen = decodedLen
+	return _r
+}
+
+// maxLengthHint bounds the allocation DecodeAll makes on the strength of a
+// total length recorded in a stream, which may be hostile.
+const maxLengthHint = 1 << 30
+
+// DecodeAll decodes the snappy framed stream read from r and returns the
+// decoded content.  The returned slice is pre-allocated to hold sizeHint bytes
+// and grows normally if the stream decodes to more.  Callers that know the
+// decoded size out-of-band avoid the repeated reallocations of
+// ioutil.ReadAll.  If sizeHint is not positive and the stream was written with
+// WithTotalLengthHeader the recorded length is used instead.  Recorded lengths
+// are verified as with VerifyTotalLength.
+func DecodeAll(r io.Reader, verifyChecksum bool, sizeHint int) ([]byte, error) {
+	var buf []byte
+	if sizeHint > 0 {
+		buf = make([]byte, 0, sizeHint)
+	}
+	_r := NewReader(r, verifyChecksum, VerifyTotalLength())
+	for first := true; ; first = false {
+		p, err := _r.nextBlock()
+		if err == io.EOF {
+			return buf, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n, ok := _r.DecodedLength(); first && ok && sizeHint <= 0 && n <= maxLengthHint {
+			buf = make([]byte, 0, n)
+		}
+		buf = append(buf, p...)
+	}
+}
+
+// DecodeStream decodes the snappy framed stream read from src and writes the
+// decoded content to dst one block at a time, returning the number of decoded
+// bytes written.  Unlike io.Copy with a Reader, decoded blocks are written
+// directly from the decoding buffers without passing through the buffer of
+// unread data.
+func DecodeStream(dst io.Writer, src io.Reader, verifyChecksum bool) (int64, error) {
+	r := NewReader(src, verifyChecksum)
+	var n int64
+	for {
+		p, err := r.nextBlock()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		m, err := dst.Write(p)
+		n += int64(m)
+		if err == nil && m != len(p) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// Verify reads the snappy framed stream from r, verifying the checksum of
+// every data block, and returns the first error encountered (corruption is
+// reported as a *CorruptionError) or nil if the stream is valid.  Decoded data
+// is discarded.
+func Verify(r io.Reader) error {
+	_r := NewReader(r, VerifyChecksum)
+	for {
+		_, err := _r.nextBlock()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Remaining returns the number of decoded bytes expected to be read from r
+// before the end of the stream.  Remaining returns -1 if r was not created
+// with NewReaderExpectedLen.
+func (r *Reader) Remaining() int64 {
+	if r.expectedLen < 0 {
+		return -1
+	}
+	return r.expectedLen - (r.decoded - int64(r.buf.Len()))
+}
+
+// VerifyLast verifies the checksum of the most recently decoded data block
+// against its decoded contents, returning a *CorruptionError if they do not
+// match, or ErrNoBlock if no data block has been decoded.  It is intended for
+// use with LazyChecksum.  VerifyLast must be called before the next block is
+// decoded; data returned by ReadBlock must not be modified before it is
+// verified.
+func (r *Reader) VerifyLast() error {
+	if !r.hasLast {
+		return ErrNoBlock
+	}
+	return r.checkLast()
+}
+
+// PaddingChunks returns the number of padding chunks r has skipped.
+func (r *Reader) PaddingChunks() int64 {
+	return r.paddingChunks
+}
+
+// SkippableChunks returns the number of reserved skippable chunks r has read,
+// including those carrying metadata understood by this package.  Padding
+// chunks are counted separately by PaddingChunks.
+func (r *Reader) SkippableChunks() int64 {
+	return r.skippableChunks
+}
+
+// DataBlocks returns the number of data blocks r has decoded successfully.
+func (r *Reader) DataBlocks() int64 {
+	return r.dataBlocks
+}
+
+// MaxDecodedBlockSeen returns the decoded length of the largest data block r
+// has read, for example to size buffers for a producer's streams.
+func (r *Reader) MaxDecodedBlockSeen() int {
+	return r.maxDecodedBlock
+}
+
+// LastBlockCompressed returns true if the most recent data block read by r
+// was a compressed block and false if it was uncompressed, as a Writer emits
+// for incompressible data.  It returns false if no block has been read.
+func (r *Reader) LastBlockCompressed() bool {
+	return r.lastCompressed
+}
+
+// VerifyAccumulated returns a *CorruptionError describing the first block
+// decoded by r whose checksum did not match, or nil if all blocks decoded so
+// far matched.  It is intended for use with AccumulateChecksums, without which
+// it always returns nil.
+func (r *Reader) VerifyAccumulated() error {
+	return r.accumulatedErr
+}
+
+// AppHeader returns the application header written by a Writer created with
+// WithAppHeader.  The header precedes all data blocks so it is available once
+// the first Read has returned.  AppHeader returns nil if the stream carries no
+// header or none has been read yet.
+func (r *Reader) AppHeader() []byte {
+	return r.appHeader
+}
+
+// Multistream controls whether r decodes concatenated streams as one.  By
+// default a stream identifier following data is skipped and decoding
+// continues, so the members of a concatenated stream are read as a single
+// stream.  If ok is false r instead reports io.EOF at the end of each member
+// and ResetStream must be called to continue with the next one.  See Trailers
+// for other treatments of data following a stream.
+func (r *Reader) Multistream(ok bool) {
+	r.singleStream = !ok
+}
+
+// ResetStream prepares r to decode the next member of a concatenated stream
+// after Read has returned io.EOF at a member boundary.  ResetStream returns
+// io.EOF if r has not stopped at a member boundary, such as when the wrapped
+// reader is exhausted.
+func (r *Reader) ResetStream() error {
+	if !r.memberEnd {
+		return io.EOF
+	}
+	r.err = nil
+	r.memberEnd = false
+	r.seenStreamID = false
+	r.implicitStreamID = false
+	r.appHeader = nil
+	r.version, r.hasVersion = 0, false
+	r.seenTerminal = false
+	r.trailer = nil
+	r.seenStreamChecksum = false
+	r.streamCRC = 0
+	r.seenStreamDigest = false
+	if r.streamDigest != nil {
+		r.streamDigest.Reset()
+	}
+	return nil
+}
+
+// Buffered returns the number of decoded bytes that can be read from r
+// without decoding another block from the wrapped reader.
+func (r *Reader) Buffered() int {
+	return r.buf.Len()
+}
+
+// Drain reads and discards the remainder of the stream, including any
+// buffered decoded bytes, and returns the number of decoded bytes discarded.
+// It is useful to keep the framing of a connection in sync after abandoning a
+// stream.  Unlike io.Copy to ioutil.Discard, Drain does not copy decoded data
+// and, when no checksum or digest must be verified, does not decompress blocks
+// at all, trusting the decoded length recorded in each block.  Drain returns a
+// nil error upon reaching the end of the stream.
+func (r *Reader) Drain() (int64, error) {
+	n := int64(r.buf.Len())
+	r.buf.Reset()
+	if r.err != nil {
+		if r.err == io.EOF {
+			return n, nil
+		}
+		return n, r.err
+	}
+
+	r.discard = !r.verifyChecksum && !r.accumulateChecksums && !r.verifyStreamChecksum && r.streamDigest == nil
+	defer func() { r.discard = false }()
+	for {
+		p, err := r.nextBlock()
+		if err == io.EOF {
+			r.err = err
+			return n, nil
+		}
+		if err != nil {
+			r.err = err
+			return n, err
+		}
+		n += int64(len(p))
+	}
+}
+
+// AtEOF returns true once r has reached the end of the wrapped reader
+// cleanly, between chunks and satisfying any options requiring a complete
+// stream.  It remains false if the stream ended with an error.
+func (r *Reader) AtEOF() bool {
+	return r.atEOF
+}
+
+// GracefulEOF returns true once r has reached the end of the wrapped reader
+// cleanly (see AtEOF) after reading the terminal marker written by a Writer
+// created with WithTerminalMarker.  A stream ending without the marker may
+// have been truncated.
+func (r *Reader) GracefulEOF() bool {
+	return r.atEOF && r.seenTerminal
+}
+
+// HeaderSeen returns true once r has read a valid stream identifier from the
+// wrapped io.Reader.  It becomes true during the first call to Read (or
+// WriteTo) that reaches the stream identifier and remains true thereafter.  A
+// stream accepted without an identifier under LenientStreamID never reports
+// the header as seen.
+func (r *Reader) HeaderSeen() bool {
+	return r.seenStreamID
+}
+
+// ReadBlock decodes exactly one data block from the stream into dst, growing
+// it only if its capacity is insufficient, and returns the decoded data.  At
+// the end of the stream ReadBlock returns io.EOF.  ReadBlock gives callers
+// block-at-a-time access to the stream with control over buffer reuse.
+//
+// ReadBlock bypasses the buffering used by Read and WriteTo, so calls to
+// ReadBlock should not be interleaved with calls to those methods.
+func (r *Reader) ReadBlock(dst []byte) ([]byte, error) {
+	if r.err != nil {
+		return dst[:0], r.err
+	}
+
+	saved := r.dst
+	r.dst = dst
+	p, err := r.nextBlock()
+	r.dst = saved
+	if err != nil {
+		r.err = err
+		return dst[:0], err
+	}
+
+	// uncompressed data is not decoded into dst.
+	if r.hdr[0] == blockUncompressed {
+		return append(dst[:0], p...), nil
+	}
+	return p, nil
+}
+
+// ReadMessage returns the decoded contents of the next data block in the
+// stream as a newly allocated slice, or in a slice previously returned to r
+// with PutBlock.  At the end of the stream ReadMessage returns io.EOF.
+//
+// ReadMessage lets block boundaries serve as message boundaries.  This only
+// holds if the producer wrote each message with Writer.WriteRecord, or with a
+// single call to Write and no message exceeded MaxBlockSize; a BufferedWriter,
+// for example, coalesces messages into shared blocks.  Like ReadBlock, calls
+// to ReadMessage should not be interleaved with calls to Read or WriteTo.
+func (r *Reader) ReadMessage() ([]byte, error) {
+	p, err := r.ReadBlock(r.spare)
+	r.spare = nil
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// PutBlock returns p, a slice returned by ReadMessage that the caller has
+// finished with, to r for reuse by the next call to ReadMessage, so that a
+// loop reading messages need not allocate for each one.  The caller must not
+// use p after calling PutBlock.
+func (r *Reader) PutBlock(p []byte) {
+	if cap(p) > cap(r.spare) {
+		r.spare = p[:0]
+	}
+}
+
+// ReadRawBlock reads the next data block in the stream and returns both its
+// encoded payload, as stored in the stream following the block's checksum,
+// and its decoded contents, so that a caller can keep the compressed form of
+// a block without compressing it again.  For an uncompressed block (see
+// LastBlockCompressed) raw and decoded are the same slice.  At the end of the
+// stream ReadRawBlock returns io.EOF.
+//
+// Both slices refer to r's internal buffers and are only valid until the next
+// call to a method of r; callers that retain them must copy them.  Like
+// ReadBlock, calls to ReadRawBlock should not be interleaved with calls to
+// Read or WriteTo.
+func (r *Reader) ReadRawBlock() (raw, decoded []byte, err error) {
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+
+	decoded, err = r.nextBlock()
+	if err != nil {
+		r.err = err
+		return nil, nil, err
+	}
+	raw = decoded
+	if r.lastCompressed {
+		raw = r.lastEncoded
+	}
+	return raw, decoded, nil
 }
 
 // WriteTo implements the io.WriterTo interface used by io.Copy.  It writes
 // decoded data from the underlying reader to w.  WriteTo returns the number of
 // bytes written along with any error encountered.
-func (r *reader) WriteTo(w io.Writer) (int64, error) {
+func (r *Reader) WriteTo(w io.Writer) (int64, error) {
 	if r.err != nil {
 		return 0, r.err
 	}
 
+	// pre-grow destinations like bytes.Buffer when the total decoded length
+	// is known, within the bound DecodeAll applies to untrusted lengths.
+	if g, ok := w.(interface {
+		Grow(int)
+	}); ok {
+		if rem := r.Remaining(); rem > 0 && rem <= maxLengthHint {
+			g.Grow(int(rem))
+		}
+	}
+
 	n, err := r.buf.WriteTo(w)
 	if err != nil {
 		// r.err doesn't need to be set because a write error occurred and the
@@ -76,7 +946,7 @@ func (r *reader) WriteTo(w io.Writer) (int64, error) {
 	// recovered from, allowing the unwritten stream to be read successfully.
 	wfallback := &bufferFallbackWriter{
 		w:   w,
-		buf: &r.buf,
+		buf: r.buf,
 	}
 	for {
 		var m int
@@ -97,7 +967,6 @@ func (r *reader) WriteTo(w io.Writer) (int64, error) {
 			return n, err
 		}
 	}
-	panic("unreachable")
 }
 
 // bufferFallbackWriter writes to an underlying io.Writer until an error
@@ -136,122 +1005,384 @@ func (w *bufferFallbackWriter) Write(b []byte) (int, error) {
 	return n, nil
 }
 
-func (r *reader) read(b []byte) (int, error) {
+func (r *Reader) read(b []byte) (int, error) {
 	n, err := r.buf.Read(b)
 	r.err = err
 	return n, err
 }
 
-func (r *reader) Read(b []byte) (int, error) {
+func (r *Reader) Read(b []byte) (int, error) {
 	if r.err != nil {
 		return 0, r.err
 	}
 
-	if r.buf.Len() < len(b) {
-		_, r.err = r.nextFrame(&r.buf)
-		if r.err == io.EOF {
-			// fill b with any remaining bytes in the buffer.
-			return r.read(b)
-		}
-		if r.err != nil {
-			return 0, r.err
+	if r.buf.Len() < len(b) && !(r.nonBlockingRead && r.buf.Len() > 0) {
+		for {
+			_, r.err = r.nextFrame(r.buf)
+			if r.err == io.EOF {
+				// fill b with any remaining bytes in the buffer.
+				return r.read(b)
+			}
+			if r.err != nil {
+				return 0, r.err
+			}
+			// an empty data block decodes to nothing.  continue so that an
+			// empty buffer isn't mistaken for the end of the stream.
+			if r.buf.Len() > 0 {
+				break
+			}
 		}
 	}
 
 	return r.read(b)
 }
 
-func (r *reader) nextFrame(w io.Writer) (int, error) {
+// nextFrame decodes the next data block in the stream and writes it to w.
+func (r *Reader) nextFrame(w io.Writer) (int, error) {
+	p, err := r.nextBlock()
+	if err != nil {
+		return 0, err
+	}
+	return w.Write(p)
+}
+
+// nextBlock reads chunks from the stream until a data block is found and
+// returns its decoded contents.  The returned slice refers to r's internal
+// buffers and is only valid until the next read.
+func (r *Reader) nextBlock() ([]byte, error) {
+	err := r.nextDataHeader()
+	if err != nil {
+		return nil, err
+	}
+	p, err := r.decodeBlock()
+	if err != nil {
+		return nil, err
+	}
+	r.dataBlocks++
+	if len(p) > 0 {
+		r.skips = 0
+	}
+	if r.onFrame != nil {
+		r.onFrame(r.offset, r.decoded)
+	}
+	return p, nil
+}
+
+// nextDataHeader reads chunks from the stream, handling or skipping all other
+// chunks, until the header of a data block has been read into r.hdr.  The
+// block's data is left unread.
+func (r *Reader) nextDataHeader() error {
 	for {
-		// read the 4-byte snappy frame header
-		_, err := io.ReadFull(r.reader, r.hdr)
-		if err != nil {
-			return 0, err
+		if r.memberEnd {
+			return io.EOF
+		}
+		if r.pendingHeader {
+			// the header of the next member's stream identifier was read
+			// when the previous member ended.
+			r.pendingHeader = false
+		} else if err := r.readHeader(); err != nil {
+			return err
+		}
+
+		// bound the work done skipping chunks without decoding data.  stream
+		// identifiers are not counted, so that many concatenated empty
+		// streams are accepted, and the count is reset by data blocks that
+		// are not empty.
+		if typ := r.hdr[0]; typ != blockCompressed && typ != blockUncompressed && typ != blockStreamIdentifier {
+			r.skips++
+			if r.maxSkips > 0 && r.skips > r.maxSkips {
+				return r.corrupt(ErrTooManySkips)
+			}
 		}
 
 		// a stream identifier may appear anywhere and contains no information.
 		// it must appear at the beginning of the stream.  when found, validate
 		// it and continue to the next block.
 		if r.hdr[0] == blockStreamIdentifier {
+			if err := r.checkTotalLength(); err != nil {
+				return err
+			}
+			if r.singleStream && (r.seenStreamID || r.implicitStreamID) {
+				return r.endMember(true)
+			}
 			err := r.readStreamID()
 			if err != nil {
-				return 0, err
+				return err
 			}
 			r.seenStreamID = true
 			continue
 		}
-		if !r.seenStreamID {
-			return 0, errMissingStreamID
+		if !r.seenStreamID && !r.implicitStreamID {
+			typ := r.hdr[0]
+			if !r.lenientStreamID || (typ != blockCompressed && typ != blockUncompressed) {
+				if r.chunkOffset == 0 && r.checkRawSnappy() {
+					return r.corrupt(ErrLooksLikeRawSnappy)
+				}
+				return r.corrupt(errMissingStreamID)
+			}
+			r.implicitStreamID = true
+		}
+
+		switch typ := r.hdr[0]; {
+		case typ == blockPadding:
+			r.paddingChunks++
+		case 0x80 <= typ && typ <= 0xfd:
+			r.skippableChunks++
 		}
 
 		switch typ := r.hdr[0]; {
 		case typ == blockCompressed || typ == blockUncompressed:
-			return r.decodeBlock(w)
+			return nil
+		case typ == chunkTerminal && decodeLength(r.hdr[1:]) == 0:
+			// other producers may use the chunk type with data of their own,
+			// which is skipped below; only the empty marker written by
+			// WithTerminalMarker ends the stream.
+			err := r.discardBlock()
+			if err != nil {
+				return err
+			}
+			r.seenTerminal = true
+			if r.singleStream && r.trailerMode != TrailerLenient {
+				return r.endMember(false)
+			}
+			continue
+		case typ == chunkAppHeader && r.appHeader == nil:
+			// headers written by WithAppHeader never exceed MaxBlockSize.
+			buf, ok, err := r.readOptional(MaxBlockSize)
+			if err != nil {
+				return err
+			}
+			if ok {
+				r.appHeader = append([]byte{}, buf...)
+			}
+			continue
+		case typ == chunkStreamDigest && r.streamDigest != nil:
+			err := r.readStreamDigest()
+			if err != nil {
+				return err
+			}
+			continue
+		case typ == chunkBlockLength:
+			err := r.readBlockLength()
+			if err != nil {
+				return err
+			}
+			continue
+		case typ == chunkVersion:
+			err := r.readVersion()
+			if err != nil {
+				return err
+			}
+			continue
+		case typ == chunkTotalLength && r.verifyTotalLength:
+			err := r.readTotalLength()
+			if err != nil {
+				return err
+			}
+			continue
+		case typ == chunkStreamChecksum && r.verifyStreamChecksum:
+			err := r.readStreamChecksum()
+			if err != nil {
+				return err
+			}
+			continue
 		case typ == blockPadding || (0x80 <= typ && typ <= 0xfd):
 			// skip blocks whose data must not be inspected (4.4 Padding, and 4.6
 			// Reserved skippable chunks).
 			err := r.discardBlock()
 			if err != nil {
-				return 0, err
+				return err
 			}
 			continue
+		case r.unknownChunk != nil:
+			// typ must be unskippable range 0x02-0x7f.  Let the handler
+			// decide whether it may be skipped.
+			typ := r.hdr[0]
+			var buf []byte
+			var err error
+			if decodeLength(r.hdr[1:]) > r.maxEncodedLen+4 {
+				// too large to buffer.  the handler sees no contents.
+				err = r.discardBlock()
+			} else {
+				buf, err = r.readBlock()
+			}
+			if err != nil {
+				return err
+			}
+			skip, err := r.unknownChunk(typ, buf)
+			if err != nil {
+				return err
+			}
+			if skip {
+				continue
+			}
+			return r.corrupt(fmt.Errorf("unrecognized unskippable frame %#x", typ))
 		default:
 			// typ must be unskippable range 0x02-0x7f.  Read the block in full
 			// and return an error (4.5 Reserved unskippable chunks).
-			err = r.discardBlock()
+			err := r.discardBlock()
 			if err != nil {
-				return 0, err
+				return err
 			}
-			return 0, fmt.Errorf("unrecognized unskippable frame %#x", r.hdr[0])
+			return r.corrupt(fmt.Errorf("unrecognized unskippable frame %#x", r.hdr[0]))
 		}
 	}
-	panic("unreachable")
 }
 
-// decodeDataBlock assumes r.hdr[0] to be either blockCompressed or
-// blockUncompressed.
-func (r *reader) decodeBlock(w io.Writer) (int, error) {
+// checkLast verifies the checksum of the most recently decoded block.
+func (r *Reader) checkLast() error {
+	actualChecksum := crc32.Checksum(r.lastBlock, r.crcTable)
+	if r.lastChecksum != actualChecksum && r.diagnoseChecksum && r.lastEncoded != nil &&
+		r.lastChecksum == crc32.Checksum(r.lastEncoded, r.crcTable) {
+		return &CorruptionError{Offset: r.lastOffset, Err: ErrChecksumOverCompressed}
+	}
+	if r.lastChecksum != actualChecksum {
+		return &CorruptionError{
+			Offset: r.lastOffset,
+			Err:    fmt.Errorf("checksum does not match %x != %x", r.lastChecksum, actualChecksum),
+		}
+	}
+	return nil
+}
+
+// readHeader reads the 4-byte snappy frame header of the next chunk into
+// r.hdr.  io.ReadFull reports a partial header as io.ErrUnexpectedEOF.
+func (r *Reader) readHeader() error {
+	r.chunkOffset = r.offset
+	if r.setDeadline != nil {
+		err := r.setDeadline()
+		if err != nil {
+			return err
+		}
+	}
+	_, err := io.ReadFull(r.reader, r.hdr)
+	if err == io.EOF && r.strictEOF && ((!r.seenStreamID && !r.implicitStreamID) || (r.expectedLen >= 0 && r.decoded < r.expectedLen)) {
+		return io.ErrUnexpectedEOF
+	}
+	if err == io.EOF && r.expectedLen >= 0 && r.decoded != r.expectedLen {
+		return &ExpectedLenError{r.expectedLen, r.decoded}
+	}
+	if err == io.EOF {
+		if err := r.checkTotalLength(); err != nil {
+			return err
+		}
+	}
+	if err == io.EOF && r.verifyStreamChecksum && !r.seenStreamChecksum {
+		return io.ErrUnexpectedEOF
+	}
+	if err == io.EOF && r.streamDigest != nil && !r.seenStreamDigest {
+		return io.ErrUnexpectedEOF
+	}
+	if err == io.EOF {
+		r.atEOF = true
+	}
+	if err != nil {
+		return err
+	}
+	r.offset += int64(len(r.hdr))
+	return nil
+}
+
+// decodeBlock assumes r.hdr[0] to be either blockCompressed or
+// blockUncompressed.  Compressed blocks are decoded into r.dst while the data
+// of uncompressed blocks is returned from r.src.
+// checkBlockHeader checks the encoded length declared by the header, in r.hdr,
+// of a data block.
+func (r *Reader) checkBlockHeader() error {
+	// data blocks must be long enough to hold a checksum.
+	length := decodeLength(r.hdr[1:])
+	if length < 4 {
+		return r.corrupt(fmt.Errorf("block data too short %d < 4", length))
+	}
+	if length > r.maxEncodedLen+4 {
+		return r.corrupt(&BlockTooLargeError{Length: int64(length), Limit: int64(r.maxEncodedLen + 4)})
+	}
+	return nil
+}
+
+func (r *Reader) decodeBlock() ([]byte, error) {
+	err := r.checkBlockHeader()
+	if err != nil {
+		return nil, err
+	}
+
 	// read compressed block data and determine if uncompressed data is too
 	// large.
 	buf, err := r.readBlock()
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	declen := len(buf[4:])
 	if r.hdr[0] == blockCompressed {
 		declen, err = snappy.DecodedLen(buf[4:])
 		if err != nil {
-			return 0, err
+			return nil, r.corrupt(err)
 		}
 	}
-	if declen > MaxBlockSize {
-		return 0, fmt.Errorf("decoded block data too large %d > %d", declen, MaxBlockSize)
+	if declen > r.maxBlockSize {
+		return nil, r.corrupt(&BlockTooLargeError{Length: int64(declen), Limit: int64(r.maxBlockSize), Decoded: true})
 	}
 
 	// decode data and verify its integrity using the little-endian crc32
 	// preceding encoded data
 	crc32le, blockdata := buf[:4], buf[4:]
-	if r.hdr[0] == blockCompressed {
-		r.dst, err = snappy.Decode(r.dst, blockdata)
+	r.lastEncoded = nil
+	r.lastCompressed = r.hdr[0] == blockCompressed
+	r.hasLast = true
+	if r.hdr[0] == blockCompressed && r.discard {
+		// only the decoded length is needed.  the contents of blockdata
+		// are meaningless and there is no last block to verify.
+		if cap(r.dst) < declen {
+			r.dst = make([]byte, declen)
+		}
+		r.dst = r.dst[:declen]
+		blockdata = r.dst
+		r.hasLast = false
+	} else if r.hdr[0] == blockCompressed {
+		r.lastEncoded = blockdata
+		r.dst, err = r.codec.Decode(r.dst[:cap(r.dst)], blockdata)
 		if err != nil {
-			return 0, err
+			return nil, r.corrupt(err)
 		}
 		blockdata = r.dst
 	}
+	r.lastBlock = blockdata
+	r.lastChecksum = decodeChecksumWith(crc32le, r.checksumMask)
+	r.lastOffset = r.chunkOffset
 	if r.verifyChecksum {
-		checksum := unmaskChecksum(uint32(crc32le[0]) | uint32(crc32le[1])<<8 | uint32(crc32le[2])<<16 | uint32(crc32le[3])<<24)
-		actualChecksum := crc32.Checksum(blockdata, crcTable)
-		if checksum != actualChecksum {
-			return 0, fmt.Errorf("checksum does not match %x != %x", checksum, actualChecksum)
+		err := r.checkLast()
+		if err != nil {
+			return nil, err
 		}
 	}
-	return w.Write(blockdata)
+	if r.accumulateChecksums && r.accumulatedErr == nil {
+		r.accumulatedErr = r.checkLast()
+	}
+	if r.expectedLen >= 0 && r.decoded+int64(len(blockdata)) > r.expectedLen {
+		return nil, &ExpectedLenError{r.expectedLen, r.decoded + int64(len(blockdata))}
+	}
+	if n := r.decoded - r.lengthStart + int64(len(blockdata)); r.lengthExpected >= 0 && n > r.lengthExpected {
+		return nil, &ExpectedLenError{r.lengthExpected, n}
+	}
+	r.decoded += int64(len(blockdata))
+	if len(blockdata) > r.maxDecodedBlock {
+		r.maxDecodedBlock = len(blockdata)
+	}
+	if r.verifyStreamChecksum {
+		r.streamCRC = crc32.Update(r.streamCRC, crcTable, blockdata)
+		r.seenStreamChecksum = false
+	}
+	if r.streamDigest != nil {
+		r.streamDigest.Write(blockdata)
+		r.seenStreamDigest = false
+	}
+	return blockdata, nil
 }
 
-func (r *reader) readStreamID() error {
+func (r *Reader) readStreamID() error {
 	// the length of the block is fixed so don't decode it from the header.
 	if !bytes.Equal(r.hdr, streamID[:4]) {
-		return fmt.Errorf("invalid stream identifier length")
+		return r.corrupt(&InvalidStreamIDError{Header: true, Bytes: append([]byte(nil), r.hdr...)})
 	}
 
 	// read the identifier block data "sNaPpY"
@@ -260,23 +1391,68 @@ func (r *reader) readStreamID() error {
 	if err != nil {
 		return err
 	}
+	r.offset += int64(len(block))
 	if !bytes.Equal(block, streamID[4:]) {
-		return fmt.Errorf("invalid stream identifier block")
+		return r.corrupt(&InvalidStreamIDError{Bytes: append([]byte(nil), block...)})
 	}
 	return nil
 }
 
-func (r *reader) discardBlock() error {
-	length := uint64(decodeLength(r.hdr[1:]))
-	_, err := noeof64(io.CopyN(ioutil.Discard, r.reader, int64(length)))
+// readStreamChecksum reads a stream checksum trailer and compares it to the
+// checksum of the data decoded since the previous trailer.
+func (r *Reader) readStreamChecksum() error {
+	buf, err := r.readBlock()
+	if err != nil {
+		return err
+	}
+	if len(buf) != 4 {
+		return r.corrupt(fmt.Errorf("invalid stream checksum length %d", len(buf)))
+	}
+	checksum := decodeChecksum(buf)
+	if checksum != r.streamCRC {
+		return r.corrupt(ErrStreamChecksum)
+	}
+	// the next trailer covers the data that follows this one.
+	r.streamCRC = 0
+	r.seenStreamChecksum = true
+	return nil
+}
+
+// discarder is implemented by readers, such as *bufio.Reader, able to skip
+// data without copying it.
+type discarder interface {
+	Discard(n int) (int, error)
+}
+
+func (r *Reader) discardBlock() error {
+	length := int64(decodeLength(r.hdr[1:]))
+	if d, ok := r.reader.(discarder); ok {
+		n, err := noeof(d.Discard(int(length)))
+		r.offset += int64(n)
+		return err
+	}
+	n, err := noeof64(io.CopyN(ioutil.Discard, r.reader, length))
+	r.offset += n
 	return err
 }
 
-func (r *reader) readBlock() ([]byte, error) {
+// readOptional reads the data of a skippable chunk interpreted by r, as
+// readSkippable does, and returns it with true.  Other producers may use the
+// same chunk types for their own purposes, so a chunk longer than limit bytes
+// is discarded, and false returned, rather than treated as corruption.
+func (r *Reader) readOptional(limit int) ([]byte, bool, error) {
+	if int(decodeLength(r.hdr[1:])) > limit {
+		return nil, false, r.discardBlock()
+	}
+	buf, err := r.readSkippable()
+	return buf, err == nil, err
+}
+
+func (r *Reader) readBlock() ([]byte, error) {
 	// check bounds on encoded length (+4 for checksum)
 	length := decodeLength(r.hdr[1:])
-	if length > (maxEncodedBlockSize + 4) {
-		return nil, fmt.Errorf("encoded block data too large %d > %d", length, (maxEncodedBlockSize + 4))
+	if length > (r.maxEncodedLen + 4) {
+		return nil, r.corrupt(&BlockTooLargeError{Length: int64(length), Limit: int64(r.maxEncodedLen + 4)})
 	}
 
 	if int(length) > len(r.src) {
@@ -288,17 +1464,35 @@ func (r *reader) readBlock() ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	r.offset += int64(length)
 
 	return buf, nil
 }
 
+// corrupt returns a *CorruptionError for err located at the current chunk.
+func (r *Reader) corrupt(err error) error {
+	return &CorruptionError{Offset: r.chunkOffset, Err: err}
+}
+
 // decodeLength decodes a 24-bit (3-byte) little-endian length from b.
 func decodeLength(b []byte) uint32 {
 	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
 }
 
-func unmaskChecksum(c uint32) uint32 {
-	x := c - 0xa282ead8
+// decodeChecksum decodes a 4-byte little-endian masked checksum from b and
+// returns it unmasked.
+func decodeChecksum(b []byte) uint32 {
+	return decodeChecksumWith(b, DefaultChecksumMask)
+}
+
+// decodeChecksumWith is like decodeChecksum but unmasks the checksum using
+// the constant mask in place of DefaultChecksumMask.
+func decodeChecksumWith(b []byte, mask uint32) uint32 {
+	return unmaskChecksum(uint32(b[0])|uint32(b[1])<<8|uint32(b[2])<<16|uint32(b[3])<<24, mask)
+}
+
+func unmaskChecksum(c, mask uint32) uint32 {
+	x := c - mask
 	return ((x >> 17) | (x << 15))
 }
 
@@ -311,6 +1505,57 @@ func noeof(n int, err error) (int, error) {
 	return n, err
 }
 
+// maxConsecutiveEmptyReads is the number of successive reads returning no
+// data and no error after which a progressReader gives up.
+const maxConsecutiveEmptyReads = 100
+
+// progressReader wraps the io.Reader of a Reader and reports io.ErrNoProgress
+// if it repeatedly returns no data and no error.  Such a reader would
+// otherwise cause io.ReadFull and io.CopyN to spin forever.  Errors returned
+// by the wrapped reader, other than io.EOF and io.ErrUnexpectedEOF which
+// callers compare directly, are wrapped so that a failure can be attributed
+// to the source while its cause remains available to errors.Is and errors.As.
+type progressReader struct {
+	r     io.Reader
+	empty int // consecutive empty reads
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	err = r.wrap(err)
+	if n > 0 || err != nil || len(b) == 0 {
+		r.empty = 0
+		return n, err
+	}
+	r.empty++
+	if r.empty >= maxConsecutiveEmptyReads {
+		return 0, io.ErrNoProgress
+	}
+	return 0, nil
+}
+
+// Discard skips n bytes, using the wrapped reader's Discard method when it has
+// one and reading through r otherwise.  Errors are wrapped as in Read.
+func (r *progressReader) Discard(n int) (int, error) {
+	if d, ok := r.r.(discarder); ok {
+		m, err := d.Discard(n)
+		if m > 0 {
+			r.empty = 0
+		}
+		return m, r.wrap(err)
+	}
+	m, err := io.CopyN(ioutil.Discard, r, int64(n))
+	return int(m), err
+}
+
+// wrap wraps an error returned by the wrapped reader.
+func (r *progressReader) wrap(err error) error {
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return fmt.Errorf("reading stream: %w", err)
+	}
+	return err
+}
+
 // noeof64 is used after long reads (e.g. io.Copy) in situations where io.EOF
 // signifies invalid formatting or corruption.
 func noeof64(n int64, err error) (int64, error) {
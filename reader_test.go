@@ -3,11 +3,14 @@ package snappystream
 import (
 	"bytes"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/mreiferson/go-snappystream/snappy-go"
 )
@@ -49,13 +52,34 @@ func TestReader_skippable(t *testing.T) {
 		t.Fatalf("write error: %v", err)
 	}
 
-	p, err := ioutil.ReadAll(NewReader(&buf, true))
+	r := NewReader(&buf, true)
+	p, err := ioutil.ReadAll(r)
 	if err != nil {
 		t.Fatalf("read error: %v", err)
 	}
 	if string(p) != "hello padding" {
 		t.Fatalf("read: unexpected content %q", string(p))
 	}
+	if r.PaddingChunks() != 2 || r.SkippableChunks() != 1 || r.DataBlocks() != 3 {
+		t.Fatalf("read: unexpected chunk counts %d padding, %d skippable, %d data",
+			r.PaddingChunks(), r.SkippableChunks(), r.DataBlocks())
+	}
+}
+
+// This test checks that a block failing its checksum is not counted by
+// DataBlocks.
+func TestReaderDataBlocksCorrupt(t *testing.T) {
+	corrupt := compressedChunk(t, []byte("corrupt"))
+	copy(corrupt[4:8], make([]byte, 4))
+	stream := bytes.Join([][]byte{streamID, compressedChunk(t, []byte("good")), corrupt}, nil)
+	r := NewReader(bytes.NewReader(stream), true)
+	_, err := ioutil.ReadAll(r)
+	if _, ok := err.(*CorruptionError); !ok {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if r.DataBlocks() != 1 {
+		t.Fatalf("counted %d data blocks", r.DataBlocks())
+	}
 }
 
 // This test checks that reserved unskippable blocks are cause decoder errors.
@@ -195,6 +219,10 @@ func TestReader_maxBlock(t *testing.T) {
 	if err == nil {
 		t.Fatal("unexpected success")
 	}
+	var tooLarge *BlockTooLargeError
+	if !errors.As(err, &tooLarge) || !tooLarge.Decoded || tooLarge.Length != MaxBlockSize+1 || tooLarge.Limit != MaxBlockSize {
+		t.Fatalf("unexpected error %v", err)
+	}
 	if len(b) > 0 {
 		t.Fatalf("unexpected read %q", b)
 	}
@@ -254,6 +282,13 @@ func TestReader_blockTooLarge(t *testing.T) {
 	if n != 0 {
 		t.Fatalf("read: read data from the stream")
 	}
+	var tooLarge *BlockTooLargeError
+	if !errors.Is(err, ErrBlockTooLarge) || !errors.As(err, &tooLarge) {
+		t.Fatalf("read: unexpected error %v", err)
+	}
+	if tooLarge.Decoded || tooLarge.Length <= tooLarge.Limit {
+		t.Fatalf("read: unexpected error fields %+v", tooLarge)
+	}
 
 	// the compressed chunk size is within the allowed encoding size
 	// (maxEncodedBlockSize). but the uncompressed data is larger than allowed.
@@ -270,6 +305,12 @@ func TestReader_blockTooLarge(t *testing.T) {
 	if n != 0 {
 		t.Fatalf("read: read data from the stream")
 	}
+	if !errors.Is(err, ErrBlockTooLarge) || !errors.As(err, &tooLarge) {
+		t.Fatalf("read: unexpected error %v", err)
+	}
+	if tooLarge.Decoded || tooLarge.Length != (1<<24)-1 || tooLarge.Limit != int64(maxEncodedBlockSize+4) {
+		t.Fatalf("read: unexpected error fields %+v", tooLarge)
+	}
 }
 
 // This test validates the reader's handling of corrupt chunks.
@@ -534,7 +575,7 @@ func TestReaderWriteTo(t *testing.T) {
 	}
 
 	r := NewReader(&encbuf, true)
-	n64, err := r.(*reader).WriteTo(&decbuf)
+	n64, err := r.WriteTo(&decbuf)
 	if err != nil {
 		t.Fatalf("decode: %v", err)
 	}
@@ -559,7 +600,7 @@ func TestReaderWriteToPreviousError(t *testing.T) {
 	var buf bytes.Buffer
 
 	// attempt the first read from the stream.
-	n, err := stream.(*reader).WriteTo(&buf)
+	n, err := stream.(*Reader).WriteTo(&buf)
 	if err == nil {
 		t.Fatalf("error expected")
 	}
@@ -568,7 +609,7 @@ func TestReaderWriteToPreviousError(t *testing.T) {
 	}
 
 	// attempt a second read from the stream.
-	n, err = stream.(*reader).WriteTo(&buf)
+	n, err = stream.(*Reader).WriteTo(&buf)
 	if err == nil {
 		t.Fatalf("error expected")
 	}
@@ -606,7 +647,7 @@ func TestReaderWriteToWriteError(t *testing.T) {
 	stream := NewReader(encodedString(origmsg), true)
 
 	// attempt to write the stream to an io.Writer that will not accept input.
-	n, err := stream.(*reader).WriteTo(unwritable(fmt.Errorf("cannot write to this writer")))
+	n, err := stream.WriteTo(unwritable(fmt.Errorf("cannot write to this writer")))
 	if err == nil {
 		t.Fatalf("error expected")
 	}
@@ -617,7 +658,7 @@ func TestReaderWriteToWriteError(t *testing.T) {
 	// the decoded message can still be read successfully because the encoded
 	// stream was not corrupt/broken.
 	var buf bytes.Buffer
-	n, err = stream.(*reader).WriteTo(&buf)
+	n, err = stream.WriteTo(&buf)
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
@@ -648,3 +689,1023 @@ func encodedString(s string) io.Reader {
 	io.WriteString(w, s)
 	return &buf
 }
+
+// This test checks that a reader created with NewReaderExpectedLen reports
+// the remaining length and detects disagreement with the decoded stream.
+func TestReaderExpectedLen(t *testing.T) {
+	msg := "hello expected length"
+
+	r := NewReaderExpectedLen(encodedString(msg), true, int64(len(msg)))
+	if r.Remaining() != int64(len(msg)) {
+		t.Fatalf("remaining: %d", r.Remaining())
+	}
+	p := make([]byte, 5)
+	_, err := io.ReadFull(r, p)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if r.Remaining() != int64(len(msg)-len(p)) {
+		t.Fatalf("remaining: %d", r.Remaining())
+	}
+	var buf bytes.Buffer
+	_, err = r.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("write to: %v", err)
+	}
+	if string(p)+buf.String() != msg {
+		t.Fatalf("read: %q", string(p)+buf.String())
+	}
+	if r.Remaining() != 0 {
+		t.Fatalf("remaining: %d", r.Remaining())
+	}
+
+	for _, n := range []int64{int64(len(msg)) - 1, int64(len(msg)) + 1} {
+		r = NewReaderExpectedLen(encodedString(msg), true, n)
+		_, err = ioutil.ReadAll(r)
+		if _, ok := err.(*ExpectedLenError); !ok {
+			t.Errorf("expected length %d: unexpected error %v", n, err)
+		}
+	}
+
+	if NewReader(encodedString(msg), true).Remaining() != -1 {
+		t.Fatalf("remaining: unknown length")
+	}
+}
+
+// This test checks that WriteTo does not pre-grow its destination to an
+// implausibly large expected length.
+func TestReaderExpectedLenWriteToHuge(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewReaderExpectedLen(encodedString("short"), true, 1<<62)
+	_, err := r.WriteTo(&buf)
+	if _, ok := err.(*ExpectedLenError); !ok {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if buf.Cap() > maxLengthHint {
+		t.Fatalf("grew buffer to %d bytes", buf.Cap())
+	}
+}
+
+// This test checks that readers with pre-sized buffers decode streams
+// regardless of the requested size.
+func TestNewReaderSize(t *testing.T) {
+	p := bytes.Repeat([]byte("hello sized reader "), 10000)
+	enc, err := encodeStreamBytes(p, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{-1, 0, 100, 4096, MaxBlockSize, 1 << 20} {
+		r := NewReaderSize(bytes.NewReader(enc), true, size)
+		if len(r.src) < 4096 || len(r.src) > MaxBlockSize {
+			t.Errorf("size %d: src buffer length %d", size, len(r.src))
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Errorf("size %d: read: %v", size, err)
+			continue
+		}
+		if !bytes.Equal(b, p) {
+			t.Errorf("size %d: unequal decompressed content", size)
+		}
+	}
+}
+
+// This test checks that the StrictEOF option rejects streams which do not end
+// cleanly.
+func TestReaderStrictEOF(t *testing.T) {
+	msg := "hello strict eof"
+
+	_, err := ioutil.ReadAll(NewReader(bytes.NewReader(nil), true, StrictEOF()))
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("empty stream: %v", err)
+	}
+	_, err = ioutil.ReadAll(NewReader(bytes.NewReader(nil), true))
+	if err != nil {
+		t.Errorf("empty stream (lenient): %v", err)
+	}
+
+	r := NewReaderExpectedLen(encodedString(msg), true, int64(len(msg))+1, StrictEOF())
+	_, err = ioutil.ReadAll(r)
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("short stream: %v", err)
+	}
+
+	r = NewReaderExpectedLen(encodedString(msg), true, int64(len(msg)), StrictEOF())
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Errorf("read: %v", err)
+	}
+	if string(b) != msg {
+		t.Errorf("read: %q", b)
+	}
+
+	// a partial header is always reported as corruption.
+	var buf bytes.Buffer
+	io.Copy(&buf, encodedString(msg))
+	buf.Write(compressedChunk(t, []byte(msg))[:3])
+	_, err = ioutil.ReadAll(NewReader(&buf, true))
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("partial header: %v", err)
+	}
+}
+
+// This test checks that corruption errors report the offset of the offending
+// chunk.
+func TestReaderCorruptionOffset(t *testing.T) {
+	first := compressedChunk(t, []byte("a valid block"))
+	second := compressedChunk(t, []byte("a corrupt block"))
+	copy(second[4:8], make([]byte, 4)) // crc checksum failure
+	stream := bytes.Join([][]byte{
+		streamID,
+		first,
+		opaqueChunk(0xfe, 100),
+		second,
+	}, nil)
+
+	_, err := ioutil.ReadAll(NewReader(bytes.NewReader(stream), true))
+	cerr, ok := err.(*CorruptionError)
+	if !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := int64(len(streamID) + len(first) + 104)
+	if cerr.Offset != want {
+		t.Fatalf("offset %d != %d", cerr.Offset, want)
+	}
+
+	_, err = ioutil.ReadAll(NewReader(bytes.NewReader(stream[len(streamID):]), true))
+	cerr, ok = err.(*CorruptionError)
+	if !ok || cerr.Offset != 0 || cerr.Err != errMissingStreamID {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// This test checks that the LenientStreamID option decodes streams missing a
+// stream identifier.
+func TestReaderLenientStreamID(t *testing.T) {
+	stream := bytes.Join([][]byte{
+		compressedChunk(t, []byte("no stream ")),
+		opaqueChunk(0xfe, 10),
+		uncompressedChunk(t, []byte("identifier")),
+	}, nil)
+
+	_, err := ioutil.ReadAll(NewReader(bytes.NewReader(stream), true))
+	if err == nil {
+		t.Fatalf("read: expected error without lenient option")
+	}
+
+	b, err := ioutil.ReadAll(NewReader(bytes.NewReader(stream), true, LenientStreamID()))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(b) != "no stream identifier" {
+		t.Fatalf("read: %q", b)
+	}
+
+	// the first chunk must still be a data block.
+	padded := append(opaqueChunk(0xfe, 10), stream...)
+	_, err = ioutil.ReadAll(NewReader(bytes.NewReader(padded), true, LenientStreamID()))
+	if err == nil {
+		t.Fatalf("read: expected error for leading padding")
+	}
+}
+
+func TestReaderHeaderSeen(t *testing.T) {
+	r := NewReader(encodedString("hello header"), true)
+	if r.HeaderSeen() {
+		t.Fatalf("header seen before reading")
+	}
+	_, err := r.Read(make([]byte, 1))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !r.HeaderSeen() {
+		t.Fatalf("header not seen after reading")
+	}
+}
+
+// This test checks that ReadBlock returns the stream one block at a time.
+func TestReaderReadBlock(t *testing.T) {
+	stream := bytes.Join([][]byte{
+		streamID,
+		compressedChunk(t, bytes.Repeat([]byte("a"), 1000)),
+		opaqueChunk(0xfe, 10),
+		uncompressedChunk(t, []byte("raw")),
+		compressedChunk(t, []byte("block")),
+	}, nil)
+
+	r := NewReader(bytes.NewReader(stream), true)
+	dst := make([]byte, 0, 2000)
+	var blocks []string
+	for {
+		p, err := r.ReadBlock(dst)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read block: %v", err)
+		}
+		if &p[:1][0] != &dst[:1][0] {
+			t.Fatalf("block not decoded into dst")
+		}
+		blocks = append(blocks, string(p))
+	}
+	want := []string{strings.Repeat("a", 1000), "raw", "block"}
+	if fmt.Sprint(blocks) != fmt.Sprint(want) {
+		t.Fatalf("read blocks %q", blocks)
+	}
+
+	// dst is grown when too small.
+	r = NewReader(bytes.NewReader(stream), true)
+	p, err := r.ReadBlock(nil)
+	if err != nil {
+		t.Fatalf("read block: %v", err)
+	}
+	if len(p) != 1000 {
+		t.Fatalf("read block of %d bytes", len(p))
+	}
+}
+
+// This test checks that checksums of uncompressed blocks are verified.
+func TestReader_uncompressedChecksum(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithNoCompression())
+	_, err := w.Write([]byte("an uncompressed block"))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	stream := buf.Bytes()
+	if stream[len(streamID)] != blockUncompressed {
+		t.Fatalf("unexpected block type %#x", stream[len(streamID)])
+	}
+
+	corrupt := append([]byte(nil), stream...)
+	corrupt[len(corrupt)-1] ^= 0x01 // corrupt the last payload byte
+
+	_, err = ioutil.ReadAll(NewReader(bytes.NewReader(corrupt), VerifyChecksum))
+	if err == nil || !strings.Contains(err.Error(), "checksum does not match") {
+		t.Fatalf("read: expected checksum mismatch, got %v", err)
+	}
+
+	b, err := ioutil.ReadAll(NewReader(bytes.NewReader(corrupt), SkipVerifyChecksum))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(b) != "an uncompressed blocj" {
+		t.Fatalf("read: %q", b)
+	}
+}
+
+// This test checks that data blocks too short to hold a checksum are
+// rejected without panicking.
+func TestReader_blockTooShort(t *testing.T) {
+	for _, typ := range []byte{blockCompressed, blockUncompressed} {
+		for length := 0; length < 4; length++ {
+			chunk := append([]byte{typ, byte(length), 0, 0}, make([]byte, length)...)
+			stream := bytes.Join([][]byte{streamID, chunk}, nil)
+			_, err := ioutil.ReadAll(NewReader(bytes.NewReader(stream), true))
+			if _, ok := err.(*CorruptionError); !ok {
+				t.Errorf("type %#x length %d: unexpected error %v", typ, length, err)
+			}
+		}
+	}
+}
+
+// This test checks that a Reader with multistream disabled stops at each
+// member of a concatenated stream and continues after ResetStream.
+func TestReaderResetStream(t *testing.T) {
+	members := []string{"first member", "second member", "third member"}
+	var rs []io.Reader
+	for _, m := range members {
+		rs = append(rs, encodedString(m))
+	}
+
+	r := NewReader(io.MultiReader(rs...), true)
+	r.Multistream(false)
+	for i, m := range members {
+		if i > 0 {
+			if err := r.ResetStream(); err != nil {
+				t.Fatalf("member %d: reset: %v", i, err)
+			}
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("member %d: %v", i, err)
+		}
+		if string(b) != m {
+			t.Fatalf("member %d: got %q, want %q", i, b, m)
+		}
+	}
+	if err := r.ResetStream(); err != io.EOF {
+		t.Fatalf("reset at end of stream: %v", err)
+	}
+
+	// by default the members are decoded as a single stream.
+	rs = rs[:0]
+	for _, m := range members {
+		rs = append(rs, encodedString(m))
+	}
+	b, err := ioutil.ReadAll(NewReader(io.MultiReader(rs...), true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != strings.Join(members, "") {
+		t.Fatalf("got %q", b)
+	}
+}
+
+// This test checks that ReadMessage returns each Write of the producer as a
+// separate, unaliased message.
+func TestReaderReadMessage(t *testing.T) {
+	msgs := []string{"first", strings.Repeat("second ", 100), "third"}
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, m := range msgs {
+		if _, err := io.WriteString(w, m); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	r := NewReader(&buf, true)
+	var got [][]byte
+	for {
+		p, err := r.ReadMessage()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read message: %v", err)
+		}
+		got = append(got, p)
+	}
+	if len(got) != len(msgs) {
+		t.Fatalf("read %d messages, want %d", len(got), len(msgs))
+	}
+	for i, m := range msgs {
+		if string(got[i]) != m {
+			t.Fatalf("message %d: got %q, want %q", i, got[i], m)
+		}
+	}
+}
+
+// This test checks that a Reader created with LazyChecksum does not verify
+// checksums while reading but detects corruption when VerifyLast is called.
+func TestReaderLazyChecksum(t *testing.T) {
+	good := compressedChunk(t, []byte("good block"))
+	bad := uncompressedChunk(t, []byte("bad block"))
+	bad[len(bad)-1] ^= 0xff // corrupt the data after computing its checksum
+	stream := bytes.Join([][]byte{streamID, good, bad}, nil)
+
+	r := NewReader(bytes.NewReader(stream), true, LazyChecksum())
+	if err := r.VerifyLast(); err != ErrNoBlock {
+		t.Fatalf("verified before reading a block: %v", err)
+	}
+	p, err := r.ReadBlock(nil)
+	if err != nil || string(p) != "good block" {
+		t.Fatalf("read block %q (%v)", p, err)
+	}
+	if err := r.VerifyLast(); err != nil {
+		t.Fatalf("verify good block: %v", err)
+	}
+	_, err = r.ReadBlock(nil)
+	if err != nil {
+		t.Fatalf("read corrupt block: %v", err)
+	}
+	err = r.VerifyLast()
+	var cerr *CorruptionError
+	if !errors.As(err, &cerr) || cerr.Offset != int64(len(streamID)+len(good)) {
+		t.Fatalf("verify corrupt block: %v", err)
+	}
+}
+
+// emptyReader returns no data and no error n times before deferring to r.
+// If r is nil it never stops returning empty reads.
+type emptyReader struct {
+	n int
+	r io.Reader
+}
+
+func (r *emptyReader) Read(b []byte) (int, error) {
+	if r.r == nil || r.n > 0 {
+		r.n--
+		return 0, nil
+	}
+	return r.r.Read(b)
+}
+
+// This test checks that a Reader tolerates a wrapped reader returning a few
+// empty reads but reports an error instead of spinning on endless ones.
+func TestReader_emptyReads(t *testing.T) {
+	b, err := ioutil.ReadAll(NewReader(&emptyReader{n: 3, r: encodedString("hello")}, true))
+	if err != nil || string(b) != "hello" {
+		t.Fatalf("read %q (%v)", b, err)
+	}
+
+	b, err = ioutil.ReadAll(NewReader(&emptyReader{n: 3, r: bytes.NewReader(nil)}, true))
+	if err != nil || len(b) != 0 {
+		t.Fatalf("read %q (%v)", b, err)
+	}
+
+	_, err = ioutil.ReadAll(NewReader(&emptyReader{}, true))
+	if err != io.ErrNoProgress {
+		t.Fatalf("read from reader without progress: %v", err)
+	}
+}
+
+// This test checks that an empty data block is not mistaken for the end of
+// the stream.
+func TestReader_emptyBlock(t *testing.T) {
+	stream := bytes.Join([][]byte{
+		streamID,
+		uncompressedChunk(t, nil),
+		compressedChunk(t, []byte("after empty block")),
+	}, nil)
+	r := NewReader(bytes.NewReader(stream), true)
+	p := make([]byte, 100)
+	n, err := r.Read(p)
+	if err != nil || string(p[:n]) != "after empty block" {
+		t.Fatalf("read %q (%v)", p[:n], err)
+	}
+}
+
+// This test checks that a long run of padding chunks is rejected according
+// to MaxConsecutiveSkips.
+func TestReaderMaxConsecutiveSkips(t *testing.T) {
+	chunks := [][]byte{streamID}
+	for i := 0; i < 10000; i++ {
+		chunks = append(chunks, opaqueChunk(0xfe, 4))
+	}
+	chunks = append(chunks, compressedChunk(t, []byte("data")))
+	stream := bytes.Join(chunks, nil)
+
+	_, err := ioutil.ReadAll(NewReader(bytes.NewReader(stream), true))
+	if !errors.Is(err, ErrTooManySkips) {
+		t.Fatalf("read with default limit: %v", err)
+	}
+
+	_, err = ioutil.ReadAll(NewReader(bytes.NewReader(stream), true, MaxConsecutiveSkips(100)))
+	var cerr *CorruptionError
+	if !errors.As(err, &cerr) || !errors.Is(err, ErrTooManySkips) {
+		t.Fatalf("read with limit: %v", err)
+	}
+	// the stream identifier does not count toward the limit.
+	if cerr.Offset != int64(len(streamID)+100*8) {
+		t.Fatalf("read with limit: error at offset %d", cerr.Offset)
+	}
+
+	p, err := ioutil.ReadAll(NewReader(bytes.NewReader(stream), true, MaxConsecutiveSkips(0)))
+	if err != nil || string(p) != "data" {
+		t.Fatalf("read without limit %q (%v)", p, err)
+	}
+}
+
+// This test checks that empty data blocks do not reset the count of skipped
+// chunks, and that stream identifiers are not counted, so that many
+// concatenated empty streams are accepted.
+func TestReaderMaxConsecutiveSkipsEmpty(t *testing.T) {
+	chunks := [][]byte{streamID}
+	for i := 0; i < 200; i++ {
+		chunks = append(chunks, opaqueChunk(0xfe, 4), uncompressedChunk(t, nil))
+	}
+	stream := bytes.Join(chunks, nil)
+	_, err := ioutil.ReadAll(NewReader(bytes.NewReader(stream), true, MaxConsecutiveSkips(100)))
+	if !errors.Is(err, ErrTooManySkips) {
+		t.Fatalf("read padding and empty blocks: %v", err)
+	}
+
+	var buf bytes.Buffer
+	for i := 0; i < 2000; i++ {
+		err = NewWriter(&buf).Close()
+		if err != nil {
+			t.Fatalf("close: %v", err)
+		}
+	}
+	buf.Write(compressedChunk(t, []byte("data")))
+	p, err := ioutil.ReadAll(NewReader(&buf, true))
+	if err != nil || string(p) != "data" {
+		t.Fatalf("read empty streams %q (%v)", p, err)
+	}
+}
+
+// This test checks that Buffered reports the decoded bytes left unread.
+func TestReaderBuffered(t *testing.T) {
+	r := NewReader(encodedString("hello buffered"), true)
+	if r.Buffered() != 0 {
+		t.Fatalf("buffered %d bytes before reading", r.Buffered())
+	}
+	_, err := r.Read(make([]byte, 5))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if r.Buffered() != len(" buffered") {
+		t.Fatalf("buffered %d bytes", r.Buffered())
+	}
+}
+
+// This test checks that AtEOF distinguishes a clean end of stream from an
+// error.
+func TestReaderAtEOF(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.WriteRecord([]byte("only message"))
+	stream := buf.Bytes()
+
+	r := NewReader(bytes.NewReader(stream), true)
+	for {
+		_, err := r.ReadMessage()
+		if err != nil {
+			break
+		}
+		if r.AtEOF() {
+			t.Fatalf("at EOF before the end of the stream")
+		}
+	}
+	if !r.AtEOF() {
+		t.Fatalf("not at EOF after reading the stream")
+	}
+
+	r = NewReader(bytes.NewReader(stream[:len(stream)-1]), true)
+	_, err := ioutil.ReadAll(r)
+	if err == nil || r.AtEOF() {
+		t.Fatalf("at EOF after truncated stream (%v)", err)
+	}
+}
+
+// This test checks that DiagnoseChecksum identifies a compressed block whose
+// checksum was computed over its compressed data.
+func TestReaderDiagnoseChecksum(t *testing.T) {
+	src := bytes.Repeat([]byte("checksum the wrong bytes "), 10)
+	encoded, err := snappy.Encode(nil, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk := make([]byte, len(encoded)+8)
+	writeHeader(chunk[:8], blockCompressed, encoded, encoded) // checksum of compressed data
+	copy(chunk[8:], encoded)
+	stream := bytes.Join([][]byte{streamID, chunk}, nil)
+
+	_, err = ioutil.ReadAll(NewReader(bytes.NewReader(stream), true, DiagnoseChecksum()))
+	if !errors.Is(err, ErrChecksumOverCompressed) {
+		t.Fatalf("read: %v", err)
+	}
+
+	_, err = ioutil.ReadAll(NewReader(bytes.NewReader(stream), true))
+	if err == nil || errors.Is(err, ErrChecksumOverCompressed) {
+		t.Fatalf("read without diagnosis: %v", err)
+	}
+}
+
+// This test checks that a Reader decodes a new stream after Reset, keeping
+// its options and reusing or growing its buffers.
+func TestReaderReset(t *testing.T) {
+	r := NewReaderSize(encodedString("first stream"), true, 4096, StrictEOF())
+	b, err := ioutil.ReadAll(r)
+	if err != nil || string(b) != "first stream" {
+		t.Fatalf("read %q (%v)", b, err)
+	}
+
+	src := &r.src[:1][0]
+	r.Reset(encodedString("second stream"))
+	if &r.src[:1][0] != src {
+		t.Fatalf("reset reallocated buffers")
+	}
+	b, err = ioutil.ReadAll(r)
+	if err != nil || string(b) != "second stream" {
+		t.Fatalf("read %q (%v) after reset", b, err)
+	}
+
+	r.ResetSize(bytes.NewReader(nil), MaxBlockSize)
+	if cap(r.src) < MaxBlockSize || cap(r.dst) < MaxBlockSize {
+		t.Fatalf("reset did not grow buffers")
+	}
+	_, err = ioutil.ReadAll(r)
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("strict EOF option lost after reset: %v", err)
+	}
+}
+
+// This test checks that a Reader created with AccumulateChecksums reads a
+// corrupt stream fully and reports the corruption through VerifyAccumulated.
+func TestReaderAccumulateChecksums(t *testing.T) {
+	good := compressedChunk(t, []byte("good block"))
+	bad := uncompressedChunk(t, []byte("bad block"))
+	bad[len(bad)-1] ^= 0xff
+	stream := bytes.Join([][]byte{streamID, good, bad, good}, nil)
+
+	r := NewReader(bytes.NewReader(stream), true, AccumulateChecksums())
+	_, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	var cerr *CorruptionError
+	if !errors.As(r.VerifyAccumulated(), &cerr) || cerr.Offset != int64(len(streamID)+len(good)) {
+		t.Fatalf("verify accumulated: %v", r.VerifyAccumulated())
+	}
+
+	r = NewReader(bytes.NewReader(bytes.Join([][]byte{streamID, good}, nil)), true, AccumulateChecksums())
+	_, err = ioutil.ReadAll(r)
+	if err != nil || r.VerifyAccumulated() != nil {
+		t.Fatalf("read valid stream: %v, %v", err, r.VerifyAccumulated())
+	}
+}
+
+// This test checks that Drain discards the remainder of a stream, decoding
+// blocks only when they must be verified.
+func TestReaderDrain(t *testing.T) {
+	p := bytes.Repeat([]byte("drain me "), 30000)
+	enc, err := encodeStreamBytes(p, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, verify := range []bool{true, false} {
+		codec := &countingCodec{}
+		r := NewReader(bytes.NewReader(enc), verify, ReaderCodec(codec))
+		_, err = io.ReadFull(r, make([]byte, 100))
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		n, err := r.Drain()
+		if err != nil {
+			t.Fatalf("drain: %v", err)
+		}
+		if n != int64(len(p)-100) {
+			t.Errorf("verify %v: drained %d bytes", verify, n)
+		}
+		if verify && int64(codec.decodes) != r.DataBlocks() {
+			t.Errorf("verify %v: decoded %d of %d blocks", verify, codec.decodes, r.DataBlocks())
+		}
+		if !verify && codec.decodes != 1 {
+			t.Errorf("verify %v: decoded %d of %d blocks", verify, codec.decodes, r.DataBlocks())
+		}
+		_, err = r.Read(make([]byte, 1))
+		if err != io.EOF {
+			t.Errorf("verify %v: read after drain: %v", verify, err)
+		}
+	}
+
+	// a checksum mismatch is reported when verifying.
+	bad := append([]byte{}, enc...)
+	bad[len(streamID)+4] ^= 0xff
+	_, err = NewReader(bytes.NewReader(bad), true).Drain()
+	var cerr *CorruptionError
+	if !errors.As(err, &cerr) {
+		t.Errorf("drain corrupt stream: %v", err)
+	}
+}
+
+// This test checks that AllowOversizeBlocks raises the limit on block size to
+// the given value.
+func TestReaderAllowOversizeBlocks(t *testing.T) {
+	big := bytes.Repeat([]byte("oversize "), 8000) // 72000 bytes
+	random := make([]byte, 70000)
+	_, err := rand.Read(random)
+	if err != nil {
+		t.Fatalf("rand: %v", err)
+	}
+	for _, p := range [][]byte{big, random} {
+		stream := bytes.Join([][]byte{streamID, compressedChunk(t, p), uncompressedChunk(t, p)}, nil)
+
+		_, err = ioutil.ReadAll(NewReader(bytes.NewReader(stream), true))
+		if !errors.Is(err, ErrBlockTooLarge) {
+			t.Errorf("strict read: %v", err)
+		}
+
+		b, err := ioutil.ReadAll(NewReader(bytes.NewReader(stream), true, AllowOversizeBlocks(80000)))
+		if err != nil {
+			t.Fatalf("lenient read: %v", err)
+		}
+		if !bytes.Equal(b, append(append([]byte{}, p...), p...)) {
+			t.Fatalf("unequal decompressed content")
+		}
+
+		_, err = ioutil.ReadAll(NewReader(bytes.NewReader(stream), true, AllowOversizeBlocks(len(p)-1)))
+		var terr *BlockTooLargeError
+		if !errors.As(err, &terr) || terr.Limit > int64(len(p)+4) {
+			t.Errorf("read with lower limit: %v", err)
+		}
+	}
+}
+
+// This test checks that the OnFrame callback reports progress after each data
+// block.
+func TestReaderOnFrame(t *testing.T) {
+	p := bytes.Repeat(testDataMan, 20)
+	enc, err := encodeStreamBytes(p, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var frames int
+	var lastOffset, lastDecoded int64
+	r := NewReader(bytes.NewReader(enc), true, OnFrame(func(compressedOffset, decodedTotal int64) {
+		frames++
+		if compressedOffset <= lastOffset || decodedTotal <= lastDecoded {
+			t.Errorf("frame %d: progress %d, %d after %d, %d", frames, compressedOffset, decodedTotal, lastOffset, lastDecoded)
+		}
+		lastOffset, lastDecoded = compressedOffset, decodedTotal
+	}))
+	_, err = io.Copy(ioutil.Discard, r)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if int64(frames) != r.DataBlocks() || frames < 2 {
+		t.Errorf("%d callbacks for %d blocks", frames, r.DataBlocks())
+	}
+	if lastOffset != int64(len(enc)) || lastDecoded != int64(len(p)) {
+		t.Errorf("final progress %d, %d", lastOffset, lastDecoded)
+	}
+}
+
+// This test checks that a malformed stream identifier is reported with the
+// offending bytes.
+func TestReaderInvalidStreamID(t *testing.T) {
+	for _, test := range []struct {
+		stream []byte
+		header bool
+		bytes  []byte
+	}{
+		{[]byte{0xff, 0x07, 0x00, 0x00, 's', 'N', 'a', 'P', 'p', 'Y', 0}, true, []byte{0xff, 0x07, 0x00, 0x00}},
+		{[]byte{0xff, 0x06, 0x00, 0x00, 'g', 'a', 'r', 'b', 'a', 'g', 'e'}, false, []byte("garbag")},
+	} {
+		_, err := ioutil.ReadAll(NewReader(bytes.NewReader(test.stream), true))
+		if !errors.Is(err, ErrInvalidStreamID) {
+			t.Errorf("%x: unexpected error %v", test.stream, err)
+			continue
+		}
+		var serr *InvalidStreamIDError
+		if !errors.As(err, &serr) || serr.Header != test.header || !bytes.Equal(serr.Bytes, test.bytes) {
+			t.Errorf("%x: unexpected error %#v", test.stream, serr)
+		}
+	}
+}
+
+// This test checks that LastBlockCompressed reports the type of each block.
+func TestReaderLastBlockCompressed(t *testing.T) {
+	stream := bytes.Join([][]byte{
+		streamID,
+		compressedChunk(t, []byte("compressed")),
+		uncompressedChunk(t, []byte("uncompressed")),
+	}, nil)
+	r := NewReader(bytes.NewReader(stream), true)
+	if r.LastBlockCompressed() {
+		t.Fatalf("compressed before reading")
+	}
+	for _, want := range []bool{true, false} {
+		_, err := r.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if r.LastBlockCompressed() != want {
+			t.Errorf("block compressed %v, want %v", r.LastBlockCompressed(), want)
+		}
+	}
+}
+
+// This test checks that ReadRawBlock returns the stored payload of each block
+// along with its decoded contents.
+func TestReaderReadRawBlock(t *testing.T) {
+	compressed := bytes.Repeat([]byte("compressed"), 10)
+	stream := bytes.Join([][]byte{
+		streamID,
+		compressedChunk(t, compressed),
+		uncompressedChunk(t, []byte("uncompressed")),
+	}, nil)
+	r := NewReader(bytes.NewReader(stream), true)
+
+	raw, decoded, err := r.ReadRawBlock()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(decoded, compressed) {
+		t.Errorf("decoded %q", decoded)
+	}
+	if !bytes.Equal(raw, compressedChunk(t, compressed)[8:]) {
+		t.Errorf("raw %x", raw)
+	}
+
+	raw, decoded, err = r.ReadRawBlock()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(raw) != "uncompressed" || string(decoded) != "uncompressed" {
+		t.Errorf("raw %q, decoded %q", raw, decoded)
+	}
+
+	_, _, err = r.ReadRawBlock()
+	if err != io.EOF {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+// This test checks that errors from the wrapped reader are returned wrapped,
+// with the cause available to errors.As, and that the error is sticky.
+func TestReaderSourceErrorChain(t *testing.T) {
+	cause := &os.PathError{Op: "read", Path: "stream", Err: errors.New("connection reset")}
+	src := io.MultiReader(encodedString("before the failure"), iotest.ErrReader(cause))
+	r := NewReader(src, true)
+	b, err := ioutil.ReadAll(r)
+	if string(b) != "before the failure" {
+		t.Fatalf("decoded %q", b)
+	}
+	for i := 0; i < 2; i++ {
+		var perr *os.PathError
+		if !errors.As(err, &perr) || perr != cause {
+			t.Fatalf("unexpected error %v", err)
+		}
+		_, err = r.Read(make([]byte, 1))
+	}
+}
+
+// failingDiscarder is a reader whose Discard method fails with err.
+type failingDiscarder struct {
+	io.Reader
+	err error
+}
+
+func (d *failingDiscarder) Discard(n int) (int, error) {
+	return 0, d.err
+}
+
+// This test checks that errors from the wrapped reader's Discard method, used
+// to skip padding, are wrapped in the same way as errors from Read.
+func TestReaderDiscardErrorChain(t *testing.T) {
+	cause := &os.PathError{Op: "read", Path: "stream", Err: errors.New("connection reset")}
+	stream := append(append([]byte{}, streamID...), opaqueChunk(0xfe, 100)...)
+	r := NewReader(&failingDiscarder{bytes.NewReader(stream), cause}, true)
+	_, err := r.Read(make([]byte, 1))
+	var perr *os.PathError
+	if !errors.As(err, &perr) || perr != cause || !strings.HasPrefix(err.Error(), "reading stream: ") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+// This test checks that MaxDecodedBlockSeen reports the largest block read.
+func TestReaderMaxDecodedBlockSeen(t *testing.T) {
+	stream := bytes.Join([][]byte{
+		streamID,
+		compressedChunk(t, make([]byte, 100)),
+		uncompressedChunk(t, make([]byte, 1000)),
+		compressedChunk(t, make([]byte, 10)),
+	}, nil)
+	r := NewReader(bytes.NewReader(stream), true)
+	_, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if r.MaxDecodedBlockSeen() != 1000 {
+		t.Fatalf("largest block %d", r.MaxDecodedBlockSeen())
+	}
+}
+
+// This test checks that with NonBlockingRead buffered data is returned without
+// reading from the source.
+func TestReaderNonBlockingRead(t *testing.T) {
+	stream := bytes.Join([][]byte{
+		streamID,
+		compressedChunk(t, []byte("first block")),
+	}, nil)
+
+	// the source blocks once the first block has been read.
+	src, w := io.Pipe()
+	go w.Write(stream)
+	r := NewReader(src, true, NonBlockingRead())
+	b := make([]byte, 5)
+	_, err := io.ReadFull(r, b)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	b = make([]byte, 100)
+	n, err := r.Read(b)
+	if err != nil || string(b[:n]) != " block" {
+		t.Fatalf("read %q (%v)", b[:n], err)
+	}
+	w.Close()
+	_, err = r.Read(b)
+	if err != io.EOF {
+		t.Fatalf("read at end of stream: %v", err)
+	}
+}
+
+// This test checks that a raw snappy block is reported as such rather than as
+// a stream missing its identifier.
+func TestReaderLooksLikeRawSnappy(t *testing.T) {
+	random := make([]byte, 100000)
+	_, err := rand.Read(random)
+	if err != nil {
+		t.Fatalf("rand: %v", err)
+	}
+	for _, p := range [][]byte{[]byte("raw snappy"), testDataMan, random} {
+		raw, err := snappy.Encode(nil, p)
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		_, err = ioutil.ReadAll(NewReader(bytes.NewReader(raw), true))
+		if !errors.Is(err, ErrLooksLikeRawSnappy) {
+			t.Errorf("%d bytes: unexpected error %v", len(p), err)
+		}
+	}
+
+	for _, p := range [][]byte{[]byte("plain text"), testDataJSON} {
+		_, err = ioutil.ReadAll(NewReader(bytes.NewReader(p), true))
+		if !errors.Is(err, errMissingStreamID) {
+			t.Errorf("%q: unexpected error %v", p[:4], err)
+		}
+	}
+}
+
+// This test checks that a message loop recycling slices with PutBlock does
+// not allocate.
+func TestReaderPutBlock(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	var short []string
+	for i := 0; i < 200; i++ {
+		err := w.WriteRecord(bytes.Repeat([]byte{byte(i)}, 100))
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		short = append(short, fmt.Sprintf("uncompressed %d", i))
+		err = w.WriteRecord([]byte(short[i]))
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	r := NewReaderSize(&buf, true, MaxBlockSize)
+	var i int
+	allocs := testing.AllocsPerRun(100, func() {
+		p, err := r.ReadMessage()
+		if err != nil || len(p) != 100 || p[0] != byte(i) {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		r.PutBlock(p)
+		p, err = r.ReadMessage()
+		if err != nil || string(p) != short[i] {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		r.PutBlock(p)
+		i++
+	})
+	if allocs != 0 {
+		t.Errorf("%v allocations per message", allocs)
+	}
+}
+
+// This test checks that an UnknownChunkHandler can skip unskippable chunks or
+// fail with its own error, and that they are rejected without one.
+func TestReaderUnknownChunkHandler(t *testing.T) {
+	stream := bytes.Join([][]byte{
+		streamID,
+		compressedChunk(t, []byte("before ")),
+		{0x05, 3, 0, 0, 'x', 'y', 'z'},
+		uncompressedChunk(t, []byte("after")),
+	}, nil)
+
+	var seen []string
+	skip := UnknownChunkHandler(func(typ byte, body []byte) (bool, error) {
+		seen = append(seen, fmt.Sprintf("%#x %s", typ, body))
+		return typ == 0x05, nil
+	})
+	b, err := ioutil.ReadAll(NewReader(bytes.NewReader(stream), true, skip))
+	if err != nil || string(b) != "before after" {
+		t.Fatalf("read %q (%v)", b, err)
+	}
+	if len(seen) != 1 || seen[0] != "0x5 xyz" {
+		t.Fatalf("handler saw %q", seen)
+	}
+
+	errRefused := errors.New("refused")
+	for i, test := range []struct {
+		opts    []ReaderOption
+		refused bool
+	}{
+		{nil, false},
+		{[]ReaderOption{UnknownChunkHandler(func(byte, []byte) (bool, error) { return false, nil })}, false},
+		{[]ReaderOption{UnknownChunkHandler(func(byte, []byte) (bool, error) { return false, errRefused })}, true},
+		{[]ReaderOption{UnknownChunkHandler(func(byte, []byte) (bool, error) { return true, errRefused })}, true},
+	} {
+		_, err = ioutil.ReadAll(NewReader(bytes.NewReader(stream), true, test.opts...))
+		if test.refused && err != errRefused {
+			t.Errorf("%d: unexpected error %v", i, err)
+		}
+		if _, ok := err.(*CorruptionError); !test.refused && !ok {
+			t.Errorf("%d: unexpected error %v", i, err)
+		}
+	}
+
+	// chunks too large to buffer are skipped without their contents.
+	large := bytes.Join([][]byte{
+		streamID,
+		opaqueChunk(0x05, int(maxEncodedBlockSize)+5),
+		uncompressedChunk(t, []byte("after")),
+	}, nil)
+	calls := 0
+	handler := UnknownChunkHandler(func(typ byte, body []byte) (bool, error) {
+		calls++
+		return body == nil, nil
+	})
+	b, err = ioutil.ReadAll(NewReader(bytes.NewReader(large), true, handler))
+	if err != nil || string(b) != "after" || calls != 1 {
+		t.Fatalf("read %q (%v), %d calls", b, err, calls)
+	}
+}
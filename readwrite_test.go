@@ -1,10 +1,13 @@
 package snappystream
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/rand"
+	"errors"
 	"io"
 	"io/ioutil"
+	"strings"
 	"testing"
 )
 
@@ -129,6 +132,71 @@ func TestBufferedWriterReader(t *testing.T) {
 
 }
 
+func TestDecodeAll(t *testing.T) {
+	enc, err := encodeStreamBytes(testDataMan, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hint := range []int{0, 100, len(testDataMan), 2 * len(testDataMan)} {
+		dec, err := DecodeAll(bytes.NewReader(enc), VerifyChecksum, hint)
+		if err != nil {
+			t.Fatalf("hint %d: %v", hint, err)
+		}
+		if !bytes.Equal(dec, testDataMan) {
+			t.Fatalf("hint %d: unequal decompressed content", hint)
+		}
+	}
+
+	_, err = DecodeAll(bytes.NewReader(enc[:len(enc)-1]), VerifyChecksum, 0)
+	if err == nil {
+		t.Fatalf("expected error decoding truncated stream")
+	}
+}
+
+func TestDecodeStream(t *testing.T) {
+	enc, err := encodeStreamBytes(testDataMan, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	n, err := DecodeStream(&buf, bytes.NewReader(enc), VerifyChecksum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(testDataMan)) || !bytes.Equal(buf.Bytes(), testDataMan) {
+		t.Fatalf("unequal decompressed content (%d bytes)", n)
+	}
+
+	_, err = DecodeStream(ioutil.Discard, bytes.NewReader(enc[:len(enc)-1]), VerifyChecksum)
+	if err == nil {
+		t.Fatalf("expected error decoding truncated stream")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	enc, err := encodeStreamBytes(testDataMan, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Verify(bytes.NewReader(enc))
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	// corrupt the last byte of the first data block.
+	bad := append([]byte{}, enc...)
+	length := decodeLength(bad[len(streamID)+1:])
+	bad[len(streamID)+4+int(length)-1] ^= 0xff
+	err = Verify(bytes.NewReader(bad))
+	cerr, ok := err.(*CorruptionError)
+	if !ok {
+		t.Fatalf("verify corrupt stream: %v", err)
+	}
+	if cerr.Offset != int64(len(streamID)) {
+		t.Fatalf("verify corrupt stream: error at offset %d", cerr.Offset)
+	}
+}
+
 func TestWriterChunk(t *testing.T) {
 	var buf bytes.Buffer
 
@@ -190,6 +258,12 @@ func BenchmarkBufferedWriterRandom(b *testing.B) {
 func BenchmarkBufferedWriterRandomNoCopy(b *testing.B) {
 	benchmarkBufferedWriterBytesNoCopy(b, randBytes(b, TestFileSize))
 }
+func BenchmarkWriterRandom_noCompression(b *testing.B) {
+	enc := func() io.WriteCloser {
+		return NewWriter(ioutil.Discard, WithNoCompression())
+	}
+	benchmarkEncode(b, enc, randBytes(b, TestFileSize))
+}
 
 // BenchmarkWriterConstant tests performance encoding maximally compressible
 // data.
@@ -226,6 +300,86 @@ func benchmarkBufferedWriterBytesNoCopy(b *testing.B, p []byte) {
 	benchmarkEncode(b, enc, p)
 }
 
+// BenchmarkWriterPreallocatedDst measures writing full blocks with a Writer
+// created with WithPreallocatedDst.  Run with -benchmem to observe that writes
+// do not allocate.
+func BenchmarkWriterPreallocatedDst(b *testing.B) {
+	p := randBytes(b, MaxBlockSize)
+	w := NewWriter(ioutil.Discard, WithPreallocatedDst())
+	b.SetBytes(int64(len(p)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := w.Write(p)
+		if err != nil {
+			b.Fatalf("write: %v", err)
+		}
+	}
+}
+
+// BenchmarkWriterSmallWrites measures encoding a log-like sequence of small
+// writes, each of which a Writer emits as its own block.
+func BenchmarkWriterSmallWrites(b *testing.B) {
+	benchmarkSmallWrites(b, func(w io.Writer) io.WriteCloser {
+		return NewWriter(w)
+	})
+}
+
+// BenchmarkBufferedWriterSmallWrites measures encoding the writes of
+// BenchmarkWriterSmallWrites with a BufferedWriter, which coalesces them into
+// full blocks.
+func BenchmarkBufferedWriterSmallWrites(b *testing.B) {
+	benchmarkSmallWrites(b, func(w io.Writer) io.WriteCloser {
+		return NewBufferedWriter(w)
+	})
+}
+
+// benchmarkSmallWrites benchmarks writing the JSON fixture to writers created
+// by enc in lines of roughly 100 bytes and logs the resulting compression
+// ratio.
+func benchmarkSmallWrites(b *testing.B, enc func(io.Writer) io.WriteCloser) {
+	var lines [][]byte
+	for p := testDataJSON; len(p) > 0; {
+		n := 100
+		if n > len(p) {
+			n = len(p)
+		}
+		lines = append(lines, p[:n])
+		p = p[n:]
+	}
+	var counter countingWriter
+	b.SetBytes(int64(len(testDataJSON)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		counter.n = 0
+		w := enc(&counter)
+		for _, line := range lines {
+			_, err := w.Write(line)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+		err := w.Close()
+		if err != nil {
+			b.Fatalf("close: %v", err)
+		}
+	}
+	b.StopTimer()
+	c := float64(len(testDataJSON)) / float64(counter.n)
+	b.Logf("%d writes compression ratio %.03g (%d byte reduction)", len(lines), c, int64(len(testDataJSON))-counter.n)
+}
+
+// countingWriter discards data written to it, counting the bytes.
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
 // benchmarkEncode benchmarks the speed at which bytes can be copied from
 // bs into writers created by enc.
 func benchmarkEncode(b *testing.B, enc func() io.WriteCloser, bs []byte) {
@@ -291,6 +445,141 @@ func BenchmarkReaderConstantNoCopy(b *testing.B) {
 	encodeAndBenchmarkReaderNoCopy(b, make([]byte, TestFileSize))
 }
 
+// BenchmarkReaderFirstBlock measures allocations decoding a stream containing
+// a single full block with a reader using the default buffer sizes.
+func BenchmarkReaderFirstBlock(b *testing.B) {
+	benchmarkReaderFirstBlock(b, func(r io.Reader) io.Reader {
+		return &readerNoCopy{NewReader(r, VerifyChecksum)}
+	})
+}
+
+// BenchmarkReaderFirstBlock_sized is like BenchmarkReaderFirstBlock but uses a
+// reader whose buffers are pre-sized with NewReaderSize.
+func BenchmarkReaderFirstBlock_sized(b *testing.B) {
+	benchmarkReaderFirstBlock(b, func(r io.Reader) io.Reader {
+		return &readerNoCopy{NewReaderSize(r, VerifyChecksum, MaxBlockSize)}
+	})
+}
+
+func benchmarkReaderFirstBlock(b *testing.B, dec func(io.Reader) io.Reader) {
+	p := bytes.Repeat(testDataJSON, MaxBlockSize/len(testDataJSON)+1)[:MaxBlockSize]
+	enc, err := encodeStreamBytes(p, true)
+	if err != nil {
+		b.Fatalf("pre-benchmark compression: %v", err)
+	}
+	b.ReportAllocs()
+	benchmarkDecode(b, dec, int64(len(p)), enc)
+}
+
+// BenchmarkReaderPadding measures decoding a stream dominated by padding
+// chunks from a bufio.Reader, which a Reader skips without copying.
+func BenchmarkReaderPadding(b *testing.B) {
+	benchmarkReaderPadding(b, func(r io.Reader) io.Reader {
+		return bufio.NewReader(r)
+	})
+}
+
+// BenchmarkReaderPadding_noDiscard is like BenchmarkReaderPadding but hides
+// the bufio.Reader's Discard method, so that padding is copied.
+func BenchmarkReaderPadding_noDiscard(b *testing.B) {
+	benchmarkReaderPadding(b, func(r io.Reader) io.Reader {
+		return struct{ io.Reader }{bufio.NewReader(r)}
+	})
+}
+
+func benchmarkReaderPadding(b *testing.B, src func(io.Reader) io.Reader) {
+	var enc bytes.Buffer
+	enc.Write(streamID)
+	padding := make([]byte, 4+16<<10)
+	padding[0], padding[2] = blockPadding, 0x40
+	block := make([]byte, 8, 9)
+	writeHeader(block, blockUncompressed, []byte("x"), []byte("x"))
+	block = append(block, 'x')
+	for enc.Len() < TestFileSize {
+		enc.Write(padding)
+		enc.Write(block)
+	}
+	b.SetBytes(int64(enc.Len()))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := io.Copy(ioutil.Discard, NewReader(src(bytes.NewReader(enc.Bytes())), VerifyChecksum))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDecodeAll measures decoding a stream into a slice pre-sized with
+// DecodeAll.
+func BenchmarkDecodeAll(b *testing.B) {
+	benchmarkReadAll(b, func(r io.Reader, size int) ([]byte, error) {
+		return DecodeAll(r, VerifyChecksum, size)
+	})
+}
+
+// BenchmarkDecodeAll_readAll measures decoding a stream into a slice with
+// ioutil.ReadAll, for comparison with BenchmarkDecodeAll.
+func BenchmarkDecodeAll_readAll(b *testing.B) {
+	benchmarkReadAll(b, func(r io.Reader, size int) ([]byte, error) {
+		return ioutil.ReadAll(NewReader(r, VerifyChecksum))
+	})
+}
+
+// BenchmarkDecodeStream measures decoding the manpage fixture with
+// DecodeStream.
+func BenchmarkDecodeStream(b *testing.B) {
+	benchmarkDecodeStream(b, func(dst io.Writer, src io.Reader) (int64, error) {
+		return DecodeStream(dst, src, VerifyChecksum)
+	})
+}
+
+// BenchmarkDecodeStream_copy measures decoding the manpage fixture with
+// io.Copy, for comparison with BenchmarkDecodeStream.
+func BenchmarkDecodeStream_copy(b *testing.B) {
+	benchmarkDecodeStream(b, func(dst io.Writer, src io.Reader) (int64, error) {
+		return io.Copy(dst, NewReader(src, VerifyChecksum))
+	})
+}
+
+func benchmarkDecodeStream(b *testing.B, decode func(io.Writer, io.Reader) (int64, error)) {
+	enc, err := encodeStreamBytes(testDataMan, false)
+	if err != nil {
+		b.Fatalf("pre-benchmark compression: %v", err)
+	}
+	b.SetBytes(int64(len(testDataMan)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n, err := decode(ioutil.Discard, bytes.NewReader(enc))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if n != int64(len(testDataMan)) {
+			b.Fatalf("read wrong amount %d != %d", n, len(testDataMan))
+		}
+	}
+}
+
+func benchmarkReadAll(b *testing.B, readAll func(io.Reader, int) ([]byte, error)) {
+	p := bytes.Repeat(testDataJSON, TestFileSize/len(testDataJSON))
+	enc, err := encodeStreamBytes(p, true)
+	if err != nil {
+		b.Fatalf("pre-benchmark compression: %v", err)
+	}
+	b.SetBytes(int64(len(p)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dec, err := readAll(bytes.NewReader(enc), len(p))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(dec) != len(p) {
+			b.Fatalf("read wrong amount %d != %d", len(dec), len(p))
+		}
+	}
+}
+
 // encodeAndBenchmarkReader is a helper that benchmarks the package
 // reader's performance given p encoded as a snappy framed stream.
 //
@@ -412,6 +701,12 @@ type writeCloserNoCopy struct {
 	io.WriteCloser
 }
 
+// readerNoCopy is an io.Reader that simply wraps another io.Reader, masking
+// implementations of interfaces like WriterTo.
+type readerNoCopy struct {
+	io.Reader
+}
+
 // nopWriteCloser is an io.WriteCloser that has a noop Close method.  This type
 // has the effect of masking the underlying writer's Close implementation if it
 // has one, or satisfying interface implementations for writers that do not
@@ -423,3 +718,93 @@ type nopWriteCloser struct {
 func (w *nopWriteCloser) Close() error {
 	return nil
 }
+
+// This test checks that a stream checksum trailer is verified by readers
+// configured to do so and ignored by others.
+func TestWriterStreamChecksum(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithStreamChecksum())
+	for _, s := range []string{"hello ", "stream ", "checksum"} {
+		_, err := io.WriteString(w, s)
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	err := w.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	stream := buf.Bytes()
+
+	for _, verify := range []bool{false, true} {
+		var opts []ReaderOption
+		if verify {
+			opts = append(opts, VerifyStreamChecksum())
+		}
+		b, err := ioutil.ReadAll(NewReader(bytes.NewReader(stream), true, opts...))
+		if err != nil {
+			t.Fatalf("read (verify %v): %v", verify, err)
+		}
+		if string(b) != "hello stream checksum" {
+			t.Fatalf("read (verify %v): %q", verify, b)
+		}
+	}
+
+	// dropping the second data block ("stream ") must be detected.
+	first := len(streamID) + 4 + int(decodeLength(stream[len(streamID)+1:]))
+	second := 4 + int(decodeLength(stream[first+1:]))
+	dropped := append(append([]byte(nil), stream[:first]...), stream[first+second:]...)
+	_, err = ioutil.ReadAll(NewReader(bytes.NewReader(dropped), true, VerifyStreamChecksum()))
+	if !errors.Is(err, ErrStreamChecksum) {
+		t.Fatalf("read with dropped block: %v", err)
+	}
+
+	// a stream missing its trailer is truncated.
+	truncated := stream[:len(stream)-8]
+	_, err = ioutil.ReadAll(NewReader(bytes.NewReader(truncated), true, VerifyStreamChecksum()))
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("read without trailer: %v", err)
+	}
+}
+
+// This test checks that stream checksums are verified across concatenated,
+// appended and resynchronized streams.
+func TestWriterStreamChecksumConcatenated(t *testing.T) {
+	var buf bytes.Buffer
+	for _, w := range []*Writer{
+		NewWriter(&buf, WithStreamChecksum()),
+		NewWriter(&buf, WithStreamChecksum()),
+		NewAppender(&buf, WithStreamChecksum()),
+		NewWriter(&buf, WithStreamChecksum(), WithResyncInterval(10)),
+	} {
+		for i := 0; i < 3; i++ {
+			_, err := io.WriteString(w, "checksummed ")
+			if err != nil {
+				t.Fatalf("write: %v", err)
+			}
+		}
+		err := w.Close()
+		if err != nil {
+			t.Fatalf("close: %v", err)
+		}
+	}
+	b, err := ioutil.ReadAll(NewReader(&buf, true, VerifyStreamChecksum()))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(b) != strings.Repeat("checksummed ", 12) {
+		t.Fatalf("decoded %q", b)
+	}
+
+	// data following the last trailer is not covered by a checksum.
+	buf.Reset()
+	w := NewWriter(&buf, WithStreamChecksum())
+	io.WriteString(w, "checksummed")
+	w.Close()
+	w = NewAppender(&buf)
+	io.WriteString(w, "unchecked")
+	_, err = ioutil.ReadAll(NewReader(&buf, true, VerifyStreamChecksum()))
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("read with unchecked data: %v", err)
+	}
+}
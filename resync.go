@@ -0,0 +1,59 @@
+package snappystream
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// NewResyncReader returns a Reader that decodes a snappy framed stream
+// starting at the first stream identifier found in r.  Bytes preceding the
+// identifier are discarded.  This allows a consumer to attach to a stream,
+// such as a live log written with WithResyncInterval, part way through.  The
+// remaining arguments are interpreted as by NewReader.
+//
+// Offsets reported by the returned Reader, such as in a *CorruptionError,
+// are relative to the identifier at which decoding began.
+func NewResyncReader(r io.Reader, verifyChecksum bool, opts ...ReaderOption) *Reader {
+	return NewReader(&resyncReader{r: bufio.NewReader(r)}, verifyChecksum, opts...)
+}
+
+// resyncReader discards data from r preceding the first stream identifier.
+type resyncReader struct {
+	r      *bufio.Reader
+	synced bool
+}
+
+func (r *resyncReader) Read(b []byte) (int, error) {
+	if !r.synced {
+		err := r.sync()
+		if err != nil {
+			return 0, err
+		}
+	}
+	return r.r.Read(b)
+}
+
+// sync discards data until the stream identifier is next in r.
+func (r *resyncReader) sync() error {
+	for {
+		p, err := r.r.Peek(len(streamID))
+		if bytes.Equal(p, streamID) {
+			r.synced = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// skip to the next byte that could begin the identifier.
+		n := len(p)
+		if i := bytes.IndexByte(p[1:], streamID[0]); i >= 0 {
+			n = i + 1
+		}
+		_, err = r.r.Discard(n)
+		if err != nil {
+			return err
+		}
+	}
+}
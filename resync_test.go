@@ -0,0 +1,50 @@
+package snappystream
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+)
+
+// This test checks that a resync reader attached part way through a stream
+// decodes from the next stream identifier, even when the identifier spans
+// reads.
+func TestResyncReader(t *testing.T) {
+	data := make([]byte, 8*MaxBlockSize)
+	_, err := rand.Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithResyncInterval(2*MaxBlockSize))
+	_, err = w.Write(data)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	stream := buf.Bytes()
+
+	// join after the first identifier and part of the first block.
+	joined := stream[len(streamID)+100:]
+	r := NewResyncReader(iotest.OneByteReader(bytes.NewReader(joined)), true)
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(b, data[2*MaxBlockSize:]) {
+		t.Fatalf("decoded %d bytes, want the last %d", len(b), len(data)-2*MaxBlockSize)
+	}
+
+	// a stream read from its beginning decodes fully.
+	b, err = ioutil.ReadAll(NewResyncReader(bytes.NewReader(stream), true))
+	if err != nil || !bytes.Equal(b, data) {
+		t.Fatalf("read from beginning: %v", err)
+	}
+
+	// input without an identifier is an empty stream.
+	b, err = ioutil.ReadAll(NewResyncReader(bytes.NewReader(data), true))
+	if err != nil || len(b) != 0 {
+		t.Fatalf("read %d bytes (%v) without an identifier", len(b), err)
+	}
+}
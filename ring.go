@@ -0,0 +1,90 @@
+package snappystream
+
+import (
+	"io"
+)
+
+// RingReader is an io.Reader that decodes a snappy framed stream into a
+// fixed-size ring buffer.  Unlike a Reader, whose buffer of unread decoded
+// data grows as needed, a RingReader never holds more than its ring size of
+// unread data: a block is only decoded once the ring has room for it, so a
+// caller that does not drain the ring simply stops decoding.  Memory use is
+// bounded by the ring size plus one decoded block.
+type RingReader struct {
+	r     *Reader
+	err   error
+	block []byte // scratch space for the decoded block
+
+	ring  []byte
+	start int // index of the first unread byte in ring
+	n     int // number of unread bytes in ring
+}
+
+// NewRingReader returns a RingReader that decodes the snappy framed stream
+// read from r into a ring buffer of size bytes.  The size is raised to the
+// largest block the Reader accepts, MaxBlockSize unless AllowOversizeBlocks is
+// given, if smaller, so that any block fits in the ring.  The remaining
+// arguments are interpreted as by NewReader.
+func NewRingReader(r io.Reader, verifyChecksum bool, size int, opts ...ReaderOption) *RingReader {
+	_r := NewReader(r, verifyChecksum, opts...)
+	if size < _r.maxBlockSize {
+		size = _r.maxBlockSize
+	}
+	return &RingReader{
+		r:    _r,
+		ring: make([]byte, size),
+	}
+}
+
+// Buffered returns the number of unread decoded bytes held in the ring.
+func (r *RingReader) Buffered() int {
+	return r.n
+}
+
+func (r *RingReader) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	for r.n == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.fill()
+	}
+
+	// copy out of the ring, wrapping around its end if needed.
+	m := 0
+	for m < len(b) && r.n > 0 {
+		end := r.start + r.n
+		if end > len(r.ring) {
+			end = len(r.ring)
+		}
+		k := copy(b[m:], r.ring[r.start:end])
+		m += k
+		r.n -= k
+		r.start = (r.start + k) % len(r.ring)
+	}
+	return m, nil
+}
+
+// fill decodes the next block into the ring if there is room for it.
+func (r *RingReader) fill() {
+	if len(r.ring)-r.n < r.r.maxBlockSize {
+		return
+	}
+	p, err := r.r.ReadBlock(r.block)
+	if err != nil {
+		r.err = err
+		return
+	}
+	r.block = p
+
+	// copy into the free space of the ring, which is large enough to hold
+	// any block, wrapping around its end if needed.
+	for len(p) > 0 {
+		i := (r.start + r.n) % len(r.ring)
+		k := copy(r.ring[i:], p)
+		p = p[k:]
+		r.n += k
+	}
+}
@@ -0,0 +1,71 @@
+package snappystream
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+)
+
+// This test checks that a RingReader decodes a stream correctly while the
+// ring wraps around and that its buffer stays bounded.
+func TestRingReader(t *testing.T) {
+	data := bytes.Repeat([]byte("ring buffer wraparound "), 50000)
+	enc, err := encodeStreamBytes(data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size := MaxBlockSize + 1000
+	r := NewRingReader(bytes.NewReader(enc), true, size)
+	var out bytes.Buffer
+	p := make([]byte, 777)
+	for {
+		n, err := r.Read(p)
+		out.Write(p[:n])
+		if r.Buffered() > size {
+			t.Fatalf("buffered %d bytes > %d", r.Buffered(), size)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatalf("decoded data does not match")
+	}
+
+	b, err := ioutil.ReadAll(iotest.OneByteReader(NewRingReader(bytes.NewReader(enc), true, 0)))
+	if err != nil || !bytes.Equal(b, data) {
+		t.Fatalf("read one byte at a time: %v", err)
+	}
+}
+
+// This test checks that a RingReader sizes its ring to hold oversize blocks
+// when they are allowed.
+func TestRingReaderOversizeBlocks(t *testing.T) {
+	var blocks [][]byte
+	var want []byte
+	for i := 0; i < 3; i++ {
+		p := make([]byte, 150000)
+		if _, err := rand.Read(p); err != nil {
+			t.Fatalf("rand: %v", err)
+		}
+		blocks = append(blocks, uncompressedChunk(t, p))
+		want = append(want, p...)
+	}
+	stream := append(append([]byte{}, streamID...), bytes.Join(blocks, nil)...)
+
+	r := NewRingReader(bytes.NewReader(stream), true, 0, AllowOversizeBlocks(1<<20))
+	b, err := ioutil.ReadAll(iotest.HalfReader(r))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(b, want) {
+		t.Fatalf("unequal decompressed content")
+	}
+}
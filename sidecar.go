@@ -0,0 +1,106 @@
+package snappystream
+
+import (
+	"io"
+
+	"github.com/mreiferson/go-snappystream/snappy-go"
+)
+
+// WithBlockLengthSidecar causes a Writer to precede each data block with a
+// small skippable chunk recording the decoded length of the block.  An index of
+// the stream can then be built with ScanBlockIndex without decompressing any
+// blocks.  Readers otherwise ignore the sidecar chunks.
+func WithBlockLengthSidecar() WriterOption {
+	return func(w *Writer) {
+		w.blockLengthSidecar = true
+	}
+}
+
+// writeBlockLength writes a sidecar chunk recording a decoded block length of
+// n bytes as a 4-byte little-endian value.  The chunk is assembled in w.hdr,
+// which is free until the header of the block itself is written, to avoid an
+// allocation for each block.
+func (w *Writer) writeBlockLength(n int) error {
+	chunk := w.hdr[:8]
+	chunk[0], chunk[1], chunk[2], chunk[3] = chunkBlockLength, 4, 0, 0
+	chunk[4], chunk[5], chunk[6], chunk[7] = byte(n), byte(n>>8), byte(n>>16), byte(n>>24)
+	return w.writeAll(chunk)
+}
+
+// ScanBlockIndex is like BuildBlockIndex but does not decode blocks.  The
+// decoded length of each block is taken from the sidecar chunk preceding it,
+// if the stream was written with WithBlockLengthSidecar, and otherwise from
+// the header of the block's snappy data.  Checksums are not verified.
+func ScanBlockIndex(r io.Reader) (BlockIndex, error) {
+	_r := NewReader(r, SkipVerifyChecksum)
+	var index BlockIndex
+	var decoded int64
+	for {
+		err := _r.nextDataHeader()
+		if err == io.EOF {
+			return index, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		declen, err := _r.scanBlockLength()
+		if err != nil {
+			return nil, err
+		}
+		if declen > MaxBlockSize {
+			return nil, _r.corrupt(&BlockTooLargeError{Length: int64(declen), Limit: MaxBlockSize, Decoded: true})
+		}
+		index = append(index, BlockEntry{
+			Offset:        _r.chunkOffset,
+			DecodedOffset: decoded,
+			DecodedLen:    declen,
+		})
+		decoded += int64(declen)
+	}
+}
+
+// readBlockLength reads a sidecar chunk, whose header is in r.hdr, recording
+// the decoded length of the following block.  Chunks of the same type that do
+// not hold a 4-byte length are skipped.
+func (r *Reader) readBlockLength() error {
+	buf, ok, err := r.readOptional(4)
+	if err != nil || !ok || len(buf) != 4 {
+		return err
+	}
+	r.sidecarLen = int(buf[0]) | int(buf[1])<<8 | int(buf[2])<<16 | int(buf[3])<<24
+	r.hasSidecar = true
+	return nil
+}
+
+// scanBlockLength consumes the data block whose header is in r.hdr and
+// returns its decoded length, which is taken from the preceding sidecar chunk
+// if there is one.
+func (r *Reader) scanBlockLength() (int, error) {
+	err := r.checkBlockHeader()
+	if err != nil {
+		return 0, err
+	}
+	sidecar := r.hasSidecar
+	r.hasSidecar = false
+	length := int(decodeLength(r.hdr[1:]))
+	if sidecar || r.hdr[0] == blockUncompressed {
+		err := r.discardBlock()
+		if err != nil {
+			return 0, err
+		}
+		if sidecar {
+			return r.sidecarLen, nil
+		}
+		return length - 4, nil
+	}
+
+	buf, err := r.readBlock()
+	if err != nil {
+		return 0, err
+	}
+	declen, err := snappy.DecodedLen(buf[4:])
+	if err != nil {
+		return 0, r.corrupt(err)
+	}
+	return declen, nil
+}
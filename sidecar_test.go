@@ -0,0 +1,85 @@
+package snappystream
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+// This test checks that ScanBlockIndex agrees with BuildBlockIndex for streams
+// with and without block length sidecars, and that sidecars are ignored by
+// readers.
+func TestScanBlockIndex(t *testing.T) {
+	p := bytes.Repeat(testDataMan, 20)
+	for _, opts := range [][]WriterOption{nil, {WithBlockLengthSidecar()}} {
+		var buf bytes.Buffer
+		w := NewBufferedWriter(&buf, opts...)
+		_, err := w.Write(p)
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		err = w.Close()
+		if err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		enc := buf.Bytes()
+
+		want, err := BuildBlockIndex(bytes.NewReader(enc))
+		if err != nil {
+			t.Fatalf("build index: %v", err)
+		}
+		index, err := ScanBlockIndex(bytes.NewReader(enc))
+		if err != nil {
+			t.Fatalf("scan index: %v", err)
+		}
+		if len(index) != len(want) || len(index) < 2 {
+			t.Fatalf("index %+v", index)
+		}
+		for i := range want {
+			if index[i] != want[i] {
+				t.Errorf("entry %d: %+v != %+v", i, index[i], want[i])
+			}
+		}
+
+		b, err := ioutil.ReadAll(NewReader(bytes.NewReader(enc), VerifyChecksum))
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if !bytes.Equal(b, p) {
+			t.Fatalf("unequal decompressed content")
+		}
+	}
+
+	// the decoded length is taken from the sidecar, not the block.
+	stream := bytes.Join([][]byte{
+		streamID,
+		{chunkBlockLength, 4, 0, 0, 7, 0, 0, 0},
+		compressedChunk(t, []byte("abc")),
+		compressedChunk(t, []byte("defg")),
+	}, nil)
+	index, err := ScanBlockIndex(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatalf("scan index: %v", err)
+	}
+	if len(index) != 2 || index[0].DecodedLen != 7 || index[1].DecodedOffset != 7 || index[1].DecodedLen != 4 {
+		t.Fatalf("index %+v", index)
+	}
+}
+
+// This test checks that ScanBlockIndex reports malformed streams with the
+// error a Reader reports.
+func TestScanBlockIndexErrors(t *testing.T) {
+	block := compressedChunk(t, []byte("scanned"))
+	for _, stream := range [][]byte{
+		block,
+		append(append([]byte{}, streamID...), 0x00, 0x02, 0x00, 0x00),
+		append(append([]byte{}, streamID...), opaqueChunk(0x02, 4)...),
+		append(append([]byte{}, streamID...), block[:6]...),
+	} {
+		_, err := ScanBlockIndex(bytes.NewReader(stream))
+		_, rerr := ioutil.ReadAll(NewReader(bytes.NewReader(stream), true))
+		if err == nil || rerr == nil || err.Error() != rerr.Error() {
+			t.Errorf("%x: error %v, Reader reports %v", stream, err, rerr)
+		}
+	}
+}
@@ -41,6 +41,17 @@ func TestEmpty(t *testing.T) {
 	}
 }
 
+func TestOverflowedLength(t *testing.T) {
+	// a varint longer than 64 bits
+	src := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00}
+	if _, err := DecodedLen(src); err == nil {
+		t.Fatal("DecodedLen: expected error")
+	}
+	if _, err := Decode(nil, src); err == nil {
+		t.Fatal("Decode: expected error")
+	}
+}
+
 func TestSmallCopy(t *testing.T) {
 	for _, ebuf := range [][]byte{nil, make([]byte, 20), make([]byte, 64)} {
 		for _, dbuf := range [][]byte{nil, make([]byte, 20), make([]byte, 64)} {
@@ -4,6 +4,7 @@
 package snappystream
 
 import (
+	"errors"
 	"hash/crc32"
 
 	"github.com/mreiferson/go-snappystream/snappy-go"
@@ -38,13 +39,40 @@ const (
 	blockStreamIdentifier = 0xff
 )
 
+// Reserved skippable chunk types used by this package to carry optional
+// metadata.  Conformant readers ignore these chunks.
+const (
+	chunkStreamChecksum = 0x80
+	chunkAppHeader      = 0x81
+	chunkStreamDigest   = 0x82
+	chunkTerminal       = 0x83
+	chunkBlockLength    = 0x84
+	chunkTotalLength    = 0x85
+	chunkVersion        = 0x86
+)
+
+// ErrStreamChecksum is reported by a Reader verifying a stream checksum
+// trailer when the checksum does not match the decoded content.  It is wrapped
+// in a *CorruptionError.
+var ErrStreamChecksum = errors.New("stream checksum does not match")
+
 // streamID is the stream identifier block that begins a valid snappy framed
 // stream.
 var streamID = []byte{0xff, 0x06, 0x00, 0x00, 0x73, 0x4e, 0x61, 0x50, 0x70, 0x59}
 
+// DefaultChecksumMask is the constant used by the checksum masking algorithm
+// described by the spec.
+const DefaultChecksumMask = 0xa282ead8
+
 // maskChecksum implements the checksum masking algorithm described by the spec.
 func maskChecksum(c uint32) uint32 {
-	return ((c >> 15) | (c << 17)) + 0xa282ead8
+	return maskChecksumWith(c, DefaultChecksumMask)
+}
+
+// maskChecksumWith masks c using the constant mask in place of
+// DefaultChecksumMask.
+func maskChecksumWith(c, mask uint32) uint32 {
+	return ((c >> 15) | (c << 17)) + mask
 }
 
 var crcTable *crc32.Table
@@ -0,0 +1,113 @@
+// Package snappytest provides helpers for testing code that consumes snappy
+// framed streams, in particular its handling of corrupt streams.
+package snappytest
+
+import (
+	"bytes"
+
+	"github.com/mreiferson/go-snappystream"
+)
+
+// CorruptionKind selects the corruption applied by Corrupt.
+type CorruptionKind int
+
+const (
+	// FlipChecksum inverts a byte of the checksum of the first data block.
+	FlipChecksum CorruptionKind = iota
+
+	// TruncateChunk removes the second half of the last chunk, so that the
+	// stream ends inside a chunk.
+	TruncateChunk
+
+	// TruncateBoundary removes the last chunk, so that the stream ends
+	// cleanly at a chunk boundary but is missing data.  Only readers that
+	// require a complete stream, e.g. with snappystream.StrictEOF and a
+	// terminal marker, can detect this.
+	TruncateBoundary
+
+	// InjectUnskippable inserts a reserved unskippable chunk after the first
+	// stream identifier.
+	InjectUnskippable
+
+	// MangleStreamID alters the data of the first stream identifier.
+	MangleStreamID
+)
+
+// streamID is the stream identifier chunk that begins a snappy framed stream.
+var streamID = []byte{0xff, 0x06, 0x00, 0x00, 0x73, 0x4e, 0x61, 0x50, 0x70, 0x59}
+
+// Stream returns p encoded as a snappy framed stream by a snappystream.Writer
+// configured with opts.  It panics if encoding fails.
+func Stream(p []byte, opts ...snappystream.WriterOption) []byte {
+	var buf bytes.Buffer
+	w := snappystream.NewWriter(&buf, opts...)
+	_, err := w.Write(p)
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+// Corrupt returns a copy of the snappy framed stream with the corruption
+// selected by kind applied.  stream itself is not modified.  Corrupt panics if
+// stream does not contain the chunk the corruption applies to, such as a data
+// block for FlipChecksum.
+func Corrupt(stream []byte, kind CorruptionKind) []byte {
+	chunks := split(stream)
+	p := append([]byte(nil), stream...)
+	switch kind {
+	case FlipChecksum:
+		for _, off := range chunks {
+			if typ := p[off]; typ == 0x00 || typ == 0x01 {
+				p[off+4] ^= 0xff
+				return p
+			}
+		}
+		panic("snappytest: no data block")
+	case TruncateChunk:
+		off := last(chunks)
+		return p[:off+(len(p)-off)/2]
+	case TruncateBoundary:
+		return p[:last(chunks)]
+	case InjectUnskippable:
+		off := first(p, chunks) + len(streamID)
+		chunk := []byte{0x02, 0x01, 0x00, 0x00, 0x00}
+		return append(p[:off:off], append(chunk, p[off:]...)...)
+	case MangleStreamID:
+		p[first(p, chunks)+len(streamID)-1]++
+		return p
+	}
+	panic("snappytest: unknown corruption kind")
+}
+
+// split returns the offsets of the chunks in stream, ignoring a trailing
+// partial chunk.
+func split(stream []byte) []int {
+	var chunks []int
+	for off := 0; off+4 <= len(stream); {
+		chunks = append(chunks, off)
+		off += 4 + (int(stream[off+1]) | int(stream[off+2])<<8 | int(stream[off+3])<<16)
+	}
+	return chunks
+}
+
+// first returns the offset of the first stream identifier in p.
+func first(p []byte, chunks []int) int {
+	for _, off := range chunks {
+		if bytes.HasPrefix(p[off:], streamID) {
+			return off
+		}
+	}
+	panic("snappytest: no stream identifier")
+}
+
+// last returns the offset of the last chunk.
+func last(chunks []int) int {
+	if len(chunks) == 0 {
+		panic("snappytest: empty stream")
+	}
+	return chunks[len(chunks)-1]
+}
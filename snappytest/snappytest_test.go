@@ -0,0 +1,45 @@
+package snappytest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/mreiferson/go-snappystream"
+)
+
+func TestCorrupt(t *testing.T) {
+	p := bytes.Repeat([]byte("corrupt "), 10000)
+	stream := Stream(p, snappystream.WithTerminalMarker())
+	orig := append([]byte(nil), stream...)
+
+	b, err := ioutil.ReadAll(snappystream.NewReader(bytes.NewReader(stream), true))
+	if err != nil || !bytes.Equal(b, p) {
+		t.Fatalf("read: %v", err)
+	}
+
+	for _, kind := range []CorruptionKind{FlipChecksum, InjectUnskippable, MangleStreamID} {
+		_, err = ioutil.ReadAll(snappystream.NewReader(bytes.NewReader(Corrupt(stream, kind)), true))
+		var cerr *snappystream.CorruptionError
+		if !errors.As(err, &cerr) {
+			t.Errorf("kind %d: unexpected error %v", kind, err)
+		}
+	}
+
+	_, err = ioutil.ReadAll(snappystream.NewReader(bytes.NewReader(Corrupt(stream, TruncateChunk)), true))
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated chunk: unexpected error %v", err)
+	}
+
+	r := snappystream.NewReader(bytes.NewReader(Corrupt(stream, TruncateBoundary)), true)
+	_, err = ioutil.ReadAll(r)
+	if err != nil || r.GracefulEOF() {
+		t.Errorf("truncated at boundary: %v, graceful %v", err, r.GracefulEOF())
+	}
+
+	if !bytes.Equal(stream, orig) {
+		t.Fatalf("stream modified")
+	}
+}
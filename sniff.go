@@ -0,0 +1,80 @@
+package snappystream
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// gzipMagic begins every gzip member (RFC 1952).
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// OpenMaybeFramed returns an io.Reader yielding the content of r, decoding it
+// if r is a snappy framed stream.  The beginning of r is inspected for the
+// stream identifier.  If it is found a Reader verifying checksums is returned.
+// Otherwise a reader returning r unmodified, including the inspected bytes,
+// is returned.  At most len(stream identifier) bytes are read from r before
+// OpenMaybeFramed returns, and inputs shorter than the identifier are returned
+// in full.
+func OpenMaybeFramed(r io.Reader) (io.Reader, error) {
+	sniff := make([]byte, len(streamID))
+	n, err := io.ReadFull(r, sniff)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	sniff = sniff[:n]
+
+	replay := io.MultiReader(bytes.NewReader(sniff), r)
+	if bytes.Equal(sniff, streamID) {
+		return NewReader(replay, VerifyChecksum), nil
+	}
+	return replay, nil
+}
+
+// OpenMaybeGzipped returns a Reader decoding the snappy framed stream in r,
+// first removing a layer of gzip compression if r begins with the gzip magic
+// number.  It is a compatibility shim for recovering streams that were
+// mistakenly gzipped after being encoded, and should only be used where such
+// streams are known to exist; NewReader rejects them.  The beginning of r is
+// read to inspect it, and an error is returned if a gzip header is present
+// but invalid.  verifyChecksum and opts are as for NewReader.
+func OpenMaybeGzipped(r io.Reader, verifyChecksum bool, opts ...ReaderOption) (*Reader, error) {
+	sniff := make([]byte, len(gzipMagic))
+	n, err := io.ReadFull(r, sniff)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	sniff = sniff[:n]
+
+	replay := io.MultiReader(bytes.NewReader(sniff), r)
+	if bytes.Equal(sniff, gzipMagic) {
+		zr, err := gzip.NewReader(replay)
+		if err != nil {
+			return nil, err
+		}
+		replay = zr
+	}
+	return NewReader(replay, verifyChecksum, opts...), nil
+}
+
+// QuickValidate checks that r plausibly holds a snappy framed stream by
+// reading only its beginning: the stream identifier must be valid and be
+// followed by a data block whose header declares a valid length, possibly
+// after skippable chunks, or by the end of the stream.  Block data is not read
+// or decoded, so QuickValidate serves as a cheap check before committing to a
+// full decode.  It returns nil if the stream looks valid, and otherwise the
+// error a Reader would report or io.ErrUnexpectedEOF if r is empty.
+func QuickValidate(r io.Reader) error {
+	_r := NewReader(r, SkipVerifyChecksum)
+	err := _r.nextDataHeader()
+	if err == io.EOF && _r.seenStreamID {
+		return nil
+	}
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return err
+	}
+	return _r.checkBlockHeader()
+}
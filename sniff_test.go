@@ -0,0 +1,118 @@
+package snappystream
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+)
+
+// This test checks that OpenMaybeFramed decodes framed input and passes other
+// input through unmodified, including input shorter than the magic.
+func TestOpenMaybeFramed(t *testing.T) {
+	for _, test := range []struct {
+		in   []byte
+		want string
+	}{
+		{streamBytes(t, "framed content"), "framed content"},
+		{[]byte("plain content"), "plain content"},
+		{[]byte("plain"), "plain"},
+		{streamID[:4], string(streamID[:4])},
+		{nil, ""},
+	} {
+		r, err := OpenMaybeFramed(bytes.NewReader(test.in))
+		if err != nil {
+			t.Fatalf("open %q: %v", test.in, err)
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("read %q: %v", test.in, err)
+		}
+		if string(b) != test.want {
+			t.Fatalf("read %q: got %q, want %q", test.in, b, test.want)
+		}
+	}
+}
+
+func streamBytes(t *testing.T, s string) []byte {
+	b, err := ioutil.ReadAll(encodedString(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// This test checks that OpenMaybeGzipped decodes framed streams with and
+// without an outer layer of gzip.
+func TestOpenMaybeGzipped(t *testing.T) {
+	enc, err := encodeStreamBytes(testDataMan, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(enc)
+	err = zw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, in := range [][]byte{enc, gz.Bytes()} {
+		r, err := OpenMaybeGzipped(bytes.NewReader(in), VerifyChecksum)
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if !bytes.Equal(b, testDataMan) {
+			t.Fatalf("unequal decompressed content")
+		}
+	}
+
+	_, err = OpenMaybeGzipped(bytes.NewReader(gzipMagic), VerifyChecksum)
+	if err == nil {
+		t.Fatalf("open succeeded with truncated gzip header")
+	}
+}
+
+// This test checks that QuickValidate accepts the beginning of valid streams
+// without reading block data and rejects malformed ones with the error a
+// Reader reports.
+func TestQuickValidate(t *testing.T) {
+	block := compressedChunk(t, bytes.Repeat([]byte("quick "), 100))
+	for _, stream := range [][]byte{
+		streamID,
+		append(append([]byte{}, streamID...), block...),
+		bytes.Join([][]byte{streamID, opaqueChunk(0xfe, 10), opaqueChunk(chunkAppHeader, 10), block}, nil),
+		append(append([]byte{}, streamID...), block[:4]...), // block data is not read
+	} {
+		err := QuickValidate(bytes.NewReader(stream))
+		if err != nil {
+			t.Errorf("%x: %v", stream, err)
+		}
+	}
+
+	for _, stream := range [][]byte{
+		nil,
+		[]byte("not snappy"),
+		streamID[:6],
+		block,
+		append(append([]byte{}, streamID...), 0x00, 0x02, 0x00, 0x00),
+		append(append([]byte{}, streamID...), 0x00, 0xff, 0xff, 0xff),
+		append(append([]byte{}, streamID...), opaqueChunk(0x02, 4)...),
+	} {
+		err := QuickValidate(bytes.NewReader(stream))
+		if err == nil {
+			t.Errorf("%x: validated", stream)
+		}
+		if len(stream) == 0 {
+			continue
+		}
+		_, rerr := ioutil.ReadAll(NewReader(bytes.NewReader(stream), true))
+		if rerr == nil || err.Error() != rerr.Error() {
+			t.Errorf("%x: error %v, Reader reports %v", stream, err, rerr)
+		}
+	}
+}
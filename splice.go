@@ -0,0 +1,81 @@
+package snappystream
+
+import (
+	"fmt"
+	"io"
+)
+
+// Splice copies the snappy framed stream read from src to dst verbatim, one
+// chunk at a time, without decoding block data.  A proxy can then forward a
+// stream without the cost of decompressing and recompressing it.  The
+// structure of the stream is validated as by a Reader: it must begin with a
+// stream identifier, chunk lengths must be within bounds and reserved
+// unskippable chunks are rejected.  Block checksums are computed over decoded
+// data and so are not verified.
+//
+// Each chunk is read in full before it is written, so that dst receives only
+// whole chunks.  Splice returns the number of bytes written to dst.  Upon
+// reaching the end of src at a chunk boundary Splice returns a nil error.
+func Splice(dst io.Writer, src io.Reader) (int64, error) {
+	r := NewReader(src, SkipVerifyChecksum)
+	var total int64
+	for {
+		err := r.readHeader()
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+
+		var chunk []byte
+		switch typ := r.hdr[0]; {
+		case typ == blockStreamIdentifier:
+			err = r.readStreamID()
+			chunk = streamID[4:]
+			r.seenStreamID = true
+		case !r.seenStreamID:
+			err = r.corrupt(errMissingStreamID)
+		case typ == blockCompressed || typ == blockUncompressed:
+			if length := decodeLength(r.hdr[1:]); length < 4 {
+				err = r.corrupt(fmt.Errorf("block data too short %d < 4", length))
+				break
+			}
+			chunk, err = r.readBlock()
+		case typ >= 0x02 && typ <= 0x7f:
+			err = r.corrupt(fmt.Errorf("unrecognized unskippable frame %#x", typ))
+		default:
+			chunk, err = r.readSkippable()
+		}
+		if err != nil {
+			return total, err
+		}
+
+		for _, p := range [][]byte{r.hdr, chunk} {
+			n, err := dst.Write(p)
+			total += int64(n)
+			if err == nil && n < len(p) {
+				err = io.ErrShortWrite
+			}
+			if err != nil {
+				return total, err
+			}
+		}
+	}
+}
+
+// readSkippable reads the data of the skippable chunk whose header is in
+// r.hdr.  Unlike readBlock the length is not limited to that of a data block.
+func (r *Reader) readSkippable() ([]byte, error) {
+	length := int(decodeLength(r.hdr[1:]))
+	if length > len(r.src) {
+		r.src = make([]byte, length)
+	}
+	buf := r.src[:length]
+	_, err := noeof(io.ReadFull(r.reader, buf))
+	if err != nil {
+		return nil, err
+	}
+	r.offset += int64(length)
+	return buf, nil
+}
@@ -0,0 +1,53 @@
+package snappystream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// This test checks that Splice forwards a stream verbatim and stops at errors
+// on chunk boundaries.
+func TestSplice(t *testing.T) {
+	stream := bytes.Join([][]byte{
+		streamID,
+		compressedChunk(t, bytes.Repeat([]byte("splice "), 1000)),
+		opaqueChunk(0xfe, 10),
+		opaqueChunk(chunkAppHeader, 100000),
+		streamID,
+		uncompressedChunk(t, []byte("raw")),
+	}, nil)
+
+	var buf bytes.Buffer
+	n, err := Splice(&buf, bytes.NewReader(stream))
+	if err != nil {
+		t.Fatalf("splice: %v", err)
+	}
+	if n != int64(len(stream)) || !bytes.Equal(buf.Bytes(), stream) {
+		t.Fatalf("spliced %d of %d bytes", n, len(stream))
+	}
+
+	// a truncated chunk is not forwarded.
+	buf.Reset()
+	n, err = Splice(&buf, bytes.NewReader(stream[:len(stream)-1]))
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("splice truncated stream: %v", err)
+	}
+	if n != int64(len(stream)-len(uncompressedChunk(t, []byte("raw")))) || !bytes.Equal(buf.Bytes(), stream[:n]) {
+		t.Fatalf("spliced %d bytes of truncated stream", n)
+	}
+
+	for _, bad := range [][]byte{
+		compressedChunk(t, []byte("no stream identifier")),
+		append(append([]byte{}, streamID...), opaqueChunk(0x02, 4)...),
+		append(append([]byte{}, streamID...), 0x00, 0x02, 0x00, 0x00, 0x00, 0x00),
+	} {
+		_, err = Splice(ioutil.Discard, bytes.NewReader(bad))
+		var cerr *CorruptionError
+		if !errors.As(err, &cerr) {
+			t.Errorf("splice %x: unexpected error %v", bad, err)
+		}
+	}
+}
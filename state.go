@@ -0,0 +1,103 @@
+package snappystream
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// stateVersion identifies the encoding of states returned by SaveState.
+const stateVersion = 1
+
+// errNotAtBoundary is returned from SaveState when r holds decoded data that
+// has not been read or has otherwise not stopped cleanly between chunks.
+var errNotAtBoundary = errors.New("reader is not at a block boundary")
+
+// errStateNotSaved is returned from SaveState when r verifies data spanning
+// the saved position that the state does not record.
+var errStateNotSaved = errors.New("reader state cannot be saved with VerifyStreamDigest or VerifyTotalLength")
+
+// SaveState returns an opaque encoding of r's position in the stream that
+// NewReaderFromState can resume from.  The state can only be saved at a block
+// boundary, when all decoded data has been read from r, and only before r has
+// encountered an error other than io.EOF.  It cannot be saved once r has
+// stopped at the end of a member of the stream (see Reader.Multistream), nor
+// by a Reader created with VerifyStreamDigest or VerifyTotalLength, whose
+// digests and lengths span the saved position.
+//
+// The saved position is the number of bytes r has consumed from its wrapped
+// reader, so the state can only be resumed against a source presenting the
+// same stream from its beginning.
+func (r *Reader) SaveState() ([]byte, error) {
+	if r.err != nil && r.err != io.EOF {
+		return nil, r.err
+	}
+	if r.buf.Len() > 0 || r.pendingHeader || r.memberEnd {
+		return nil, errNotAtBoundary
+	}
+	if r.streamDigest != nil || r.verifyTotalLength {
+		return nil, errStateNotSaved
+	}
+
+	var flags byte
+	if r.seenStreamID {
+		flags |= 1
+	}
+	if r.implicitStreamID {
+		flags |= 2
+	}
+	if r.seenStreamChecksum {
+		flags |= 4
+	}
+	if r.seenTerminal {
+		flags |= 8
+	}
+
+	state := make([]byte, 2+2*binary.MaxVarintLen64+4)
+	state[0] = stateVersion
+	state[1] = flags
+	n := 2
+	n += binary.PutUvarint(state[n:], uint64(r.offset))
+	n += binary.PutUvarint(state[n:], uint64(r.decoded))
+	binary.LittleEndian.PutUint32(state[n:], r.streamCRC)
+	return state[:n+4], nil
+}
+
+// NewReaderFromState returns a Reader that resumes decoding the stream read
+// from r at the position recorded by SaveState.  r is seeked to the saved
+// offset relative to its beginning.  The remaining arguments are interpreted
+// as by NewReader and should match those of the Reader the state was saved
+// from.
+func NewReaderFromState(r io.ReadSeeker, state []byte, verifyChecksum bool, opts ...ReaderOption) (*Reader, error) {
+	if len(state) < 2 || state[0] != stateVersion {
+		return nil, fmt.Errorf("invalid reader state")
+	}
+	flags := state[1]
+	b := state[2:]
+	offset, n := binary.Uvarint(b)
+	if n <= 0 || int64(offset) < 0 {
+		return nil, fmt.Errorf("invalid reader state")
+	}
+	b = b[n:]
+	decoded, n := binary.Uvarint(b)
+	if n <= 0 || int64(decoded) < 0 || len(b[n:]) != 4 {
+		return nil, fmt.Errorf("invalid reader state")
+	}
+	b = b[n:]
+
+	_, err := r.Seek(int64(offset), io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	_r := NewReader(r, verifyChecksum, opts...)
+	_r.seenStreamID = flags&1 != 0
+	_r.implicitStreamID = flags&2 != 0
+	_r.seenStreamChecksum = flags&4 != 0
+	_r.seenTerminal = flags&8 != 0
+	_r.offset = int64(offset)
+	_r.decoded = int64(decoded)
+	_r.streamCRC = binary.LittleEndian.Uint32(b)
+	return _r, nil
+}
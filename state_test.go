@@ -0,0 +1,100 @@
+package snappystream
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// This test checks that a Reader resumed from a saved state decodes the
+// remainder of the stream.
+func TestReaderSaveState(t *testing.T) {
+	records := []string{"first block", "second block", "third block"}
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, rec := range records {
+		err := w.WriteRecord([]byte(rec))
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	stream := buf.Bytes()
+
+	r := NewReader(bytes.NewReader(stream), true)
+	p := make([]byte, len(records[0]))
+	_, err := io.ReadFull(r, p)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	state, err := r.SaveState()
+	if err != nil {
+		t.Fatalf("save state: %v", err)
+	}
+
+	r, err = NewReaderFromState(bytes.NewReader(stream), state, true)
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read resumed: %v", err)
+	}
+	if string(b) != records[1]+records[2] {
+		t.Fatalf("read resumed %q", b)
+	}
+
+	// state cannot be saved with decoded data left unread.
+	r = NewReader(bytes.NewReader(stream), true)
+	_, err = r.Read(make([]byte, 1))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	_, err = r.SaveState()
+	if err != errNotAtBoundary {
+		t.Fatalf("save state mid-block: %v", err)
+	}
+
+	// a verified stream checksum trailer is recorded in the state.
+	var cbuf bytes.Buffer
+	w = NewWriter(&cbuf, WithStreamChecksum())
+	err = w.WriteRecord([]byte(records[0]))
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	r = NewReader(bytes.NewReader(cbuf.Bytes()), true, VerifyStreamChecksum())
+	_, err = ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	state, err = r.SaveState()
+	if err != nil {
+		t.Fatalf("save state at end of stream: %v", err)
+	}
+	r, err = NewReaderFromState(bytes.NewReader(cbuf.Bytes()), state, true, VerifyStreamChecksum())
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	_, err = r.Read(make([]byte, 1))
+	if err != io.EOF {
+		t.Fatalf("read resumed at end of stream: %v", err)
+	}
+
+	// nor by readers verifying data that spans the saved position.
+	for _, opt := range []ReaderOption{VerifyStreamDigest(sha256.New()), VerifyTotalLength()} {
+		r = NewReader(bytes.NewReader(stream), true, opt)
+		_, err = r.SaveState()
+		if err != errStateNotSaved {
+			t.Fatalf("save state: %v", err)
+		}
+	}
+
+	_, err = NewReaderFromState(bytes.NewReader(stream), []byte{0xff}, true)
+	if err == nil {
+		t.Fatalf("resumed from invalid state")
+	}
+}
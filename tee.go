@@ -0,0 +1,72 @@
+package snappystream
+
+import (
+	"hash"
+	"io"
+)
+
+// TeeWriter is an io.WriteCloser that encodes its input as a snappy framed
+// stream, like a Writer, and also forwards the uncompressed input to a second
+// io.Writer.  This allows producing both the compressed and uncompressed forms
+// of data in one pass.
+type TeeWriter struct {
+	w   *Writer
+	tee io.Writer
+}
+
+// NewTeeWriter returns a TeeWriter that writes a snappy framed stream to w and
+// the uncompressed input to tee.  The options opts configure the Writer
+// encoding the stream.
+func NewTeeWriter(w io.Writer, tee io.Writer, opts ...WriterOption) *TeeWriter {
+	return &TeeWriter{
+		w:   NewWriter(w, opts...),
+		tee: tee,
+	}
+}
+
+// Write encodes p to the framed stream and then writes p, unmodified and in a
+// single call, to the tee.  An error from either destination is returned.
+func (t *TeeWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	n, err = t.tee.Write(p)
+	if err == nil && n != len(p) {
+		err = io.ErrShortWrite
+	}
+	return n, err
+}
+
+// Close finalizes the framed stream.  See Writer.Close.  The tee is not
+// closed.
+func (t *TeeWriter) Close() error {
+	return t.w.Close()
+}
+
+// HashWriter is an io.WriteCloser that encodes its input as a snappy framed
+// stream, like a Writer, while computing a hash of the uncompressed input, for
+// example to address the content by its SHA-256 digest without a separate
+// pass over the data.
+type HashWriter struct {
+	*TeeWriter
+	h hash.Hash
+}
+
+// NewHashWriter returns a HashWriter that writes a snappy framed stream to w
+// and the uncompressed input to h.  The options opts configure the Writer
+// encoding the stream.
+func NewHashWriter(w io.Writer, h hash.Hash, opts ...WriterOption) *HashWriter {
+	return &HashWriter{
+		TeeWriter: NewTeeWriter(w, h, opts...),
+		h:         h,
+	}
+}
+
+// Sum returns the hash of all data written to w.  It covers the original
+// uncompressed bytes, not the framed stream.  Sum is only complete once all
+// data has been written and may be called before or after Close.
+func (w *HashWriter) Sum() []byte {
+	return w.h.Sum(nil)
+}
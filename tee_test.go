@@ -0,0 +1,87 @@
+package snappystream
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"testing"
+)
+
+// This test checks that a TeeWriter produces both the framed stream and the
+// uncompressed input.
+func TestTeeWriter(t *testing.T) {
+	var enc, dec bytes.Buffer
+	w := NewTeeWriter(&enc, &dec)
+	big := make([]byte, MaxBlockSize+1)
+	for _, p := range [][]byte{[]byte("hello "), big, []byte("tee")} {
+		n, err := w.Write(p)
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if n != len(p) {
+			t.Fatalf("short write %d", n)
+		}
+	}
+	err := w.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	want := append(append([]byte("hello "), big...), "tee"...)
+	if !bytes.Equal(dec.Bytes(), want) {
+		t.Fatalf("unequal tee content")
+	}
+	b, err := ioutil.ReadAll(NewReader(&enc, VerifyChecksum))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(b, want) {
+		t.Fatalf("unequal decompressed content")
+	}
+
+	// errors from the tee are reported.
+	w = NewTeeWriter(ioutil.Discard, unwritable(fmt.Errorf("cannot write to tee")))
+	_, err = w.Write([]byte("hello"))
+	if err == nil {
+		t.Fatalf("write: expected tee error")
+	}
+
+	// errors from the framed destination are reported.
+	w = NewTeeWriter(unwritable(fmt.Errorf("cannot write")), ioutil.Discard)
+	_, err = w.Write([]byte("hello"))
+	if err == nil {
+		t.Fatalf("write: expected error")
+	}
+}
+
+// This test checks that a HashWriter hashes the uncompressed input while
+// encoding it.
+func TestHashWriter(t *testing.T) {
+	var enc bytes.Buffer
+	w := NewHashWriter(&enc, sha256.New())
+	p := bytes.Repeat(testDataMan, 10)
+	_, err := w.Write(p)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	want := sha256.Sum256(p)
+	if !bytes.Equal(w.Sum(), want[:]) {
+		t.Fatalf("sum before close %x != %x", w.Sum(), want)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if !bytes.Equal(w.Sum(), want[:]) {
+		t.Fatalf("sum after close %x != %x", w.Sum(), want)
+	}
+
+	b, err := ioutil.ReadAll(NewReader(&enc, VerifyChecksum))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(b, p) {
+		t.Fatalf("unequal decompressed content")
+	}
+}
@@ -0,0 +1,109 @@
+package snappystream
+
+import (
+	"sync"
+	"time"
+)
+
+// ThrottledReader is an io.Reader that returns the data decoded by a Reader no
+// faster than a configured number of bytes per second, so that a background
+// job does not saturate the CPU or I/O it shares with other work.  Decoding is
+// paused between blocks: each block is decoded in full and then, if the limit
+// has been exceeded, ThrottledReader sleeps before returning it.  Up to one
+// second's worth of data may be returned without sleeping after a period of
+// inactivity.
+//
+// The limit may be changed with SetLimit while another goroutine is reading.
+type ThrottledReader struct {
+	r *Reader
+
+	mu     sync.Mutex
+	limit  int64   // bytes per second, unlimited if non-positive
+	tokens float64 // bytes that may be returned without sleeping
+	last   time.Time
+
+	buf     []byte // decoded block
+	pending []byte // part of buf not yet returned
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// NewThrottledReader returns a ThrottledReader returning the data decoded by r
+// at no more than bytesPerSec bytes per second.  A non-positive bytesPerSec
+// disables throttling.  Calls to r's methods should not be interleaved with
+// calls to the returned reader.
+func NewThrottledReader(r *Reader, bytesPerSec int64) *ThrottledReader {
+	return &ThrottledReader{
+		r:     r,
+		limit: bytesPerSec,
+		now:   time.Now,
+		sleep: time.Sleep,
+	}
+}
+
+// SetLimit changes t's limit to bytesPerSec bytes per second, taking effect
+// from the next block.  A non-positive bytesPerSec disables throttling.
+func (t *ThrottledReader) SetLimit(bytesPerSec int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.limit = bytesPerSec
+}
+
+// Limit returns t's current limit in bytes per second.
+func (t *ThrottledReader) Limit() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.limit
+}
+
+// Read implements the io.Reader interface.
+func (t *ThrottledReader) Read(b []byte) (int, error) {
+	if len(t.pending) == 0 {
+		p, err := t.r.ReadBlock(t.buf)
+		if err != nil {
+			return 0, err
+		}
+		t.buf = p
+		t.pending = p
+		t.wait(len(p))
+	}
+
+	n := copy(b, t.pending)
+	t.pending = t.pending[n:]
+	return n, nil
+}
+
+// wait takes n bytes from the token bucket, sleeping until the bucket is no
+// longer in debt if necessary.
+func (t *ThrottledReader) wait(n int) {
+	t.mu.Lock()
+	limit := float64(t.limit)
+	if limit <= 0 {
+		t.last = time.Time{}
+		t.mu.Unlock()
+		return
+	}
+	now := t.now()
+	if t.last.IsZero() {
+		t.tokens = limit
+	} else {
+		t.tokens += now.Sub(t.last).Seconds() * limit
+		if t.tokens > limit {
+			t.tokens = limit
+		}
+	}
+	t.last = now
+	t.tokens -= float64(n)
+	var d time.Duration
+	if t.tokens < 0 {
+		d = time.Duration(-t.tokens / limit * float64(time.Second))
+	}
+	t.mu.Unlock()
+
+	if d > 0 {
+		t.sleep(d)
+	}
+}
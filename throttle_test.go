@@ -0,0 +1,68 @@
+package snappystream
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// This test checks that a ThrottledReader sleeps to stay under its limit and
+// that the limit can be changed while reading.
+func TestThrottledReader(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for i := 0; i < 10; i++ {
+		err := w.WriteRecord(bytes.Repeat([]byte{byte(i)}, 1000))
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	enc := buf.Bytes()
+
+	var clock time.Time
+	var slept time.Duration
+	throttled := func(limit int64) *ThrottledReader {
+		tr := NewThrottledReader(NewReader(bytes.NewReader(enc), true), limit)
+		clock, slept = time.Unix(0, 0), 0
+		tr.now = func() time.Time { return clock }
+		tr.sleep = func(d time.Duration) {
+			clock = clock.Add(d)
+			slept += d
+		}
+		return tr
+	}
+
+	// the first second's worth of data is returned immediately.
+	tr := throttled(1000)
+	b, err := ioutil.ReadAll(tr)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(b) != 10000 {
+		t.Fatalf("read %d bytes", len(b))
+	}
+	if slept != 9*time.Second {
+		t.Fatalf("slept %v", slept)
+	}
+
+	tr = throttled(1000)
+	p := make([]byte, 1000)
+	for i := 0; i < 5; i++ {
+		_, err = tr.Read(p)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+	}
+	tr.SetLimit(0)
+	if tr.Limit() != 0 {
+		t.Fatalf("limit %d", tr.Limit())
+	}
+	b, err = ioutil.ReadAll(tr)
+	if err != nil || len(b) != 5000 {
+		t.Fatalf("read %d bytes (%v)", len(b), err)
+	}
+	if slept != 4*time.Second {
+		t.Fatalf("slept %v after disabling limit", slept)
+	}
+}
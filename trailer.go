@@ -0,0 +1,106 @@
+package snappystream
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+// ErrTrailingData is returned by a Reader created with Trailers(TrailerError)
+// when data follows the end of the stream.
+var ErrTrailingData = errors.New("unexpected data after end of stream")
+
+// ErrTrailerTooLarge is returned by a Reader created with
+// Trailers(TrailerExpose) when more than MaxTrailerLen bytes follow the end
+// of the stream.
+var ErrTrailerTooLarge = errors.New("data after end of stream too large")
+
+// MaxTrailerLen is the largest amount of data following the end of the stream
+// that a Reader created with Trailers(TrailerExpose) reads into memory.
+const MaxTrailerLen = 1 << 20
+
+// TrailerMode determines how a Reader with multistream disabled (see
+// Reader.Multistream) treats data following the end of the stream.  With any
+// mode other than TrailerLenient the stream ends at a terminal marker (see
+// WithTerminalMarker) as well as at a stream identifier following data.  A
+// chunk of the terminal marker's type that is not empty was not written by
+// WithTerminalMarker and is skipped like any other skippable chunk.
+type TrailerMode int
+
+const (
+	// TrailerLenient stops at a stream identifier following data, which
+	// ResetStream can continue from, and otherwise reads on.  Chunks after
+	// a terminal marker are decoded as part of the stream.  It is the
+	// default.
+	TrailerLenient TrailerMode = iota
+
+	// TrailerIgnore stops at the end of the stream without inspecting any
+	// data that follows it.
+	TrailerIgnore
+
+	// TrailerError returns ErrTrailingData if any data follows the end of
+	// the stream, for strict validation of single-stream input.
+	TrailerError
+
+	// TrailerExpose reads all data following the end of the stream and
+	// makes it available from Reader.Trailer.  Data beyond MaxTrailerLen
+	// bytes is not read and ErrTrailerTooLarge is returned instead.
+	TrailerExpose
+)
+
+// Trailers causes a Reader with multistream disabled to treat data following
+// the end of the stream according to mode.  It has no effect on a Reader
+// decoding concatenated streams as one, which is the default.
+func Trailers(mode TrailerMode) ReaderOption {
+	return func(r *Reader) {
+		r.trailerMode = mode
+	}
+}
+
+// Trailer returns the data that followed the end of the stream, read by a
+// Reader created with Trailers(TrailerExpose) once Read has returned io.EOF.
+// It returns nil if nothing followed the stream or it has not been reached.
+func (r *Reader) Trailer() []byte {
+	return r.trailer
+}
+
+// endMember stops r at the end of the current member of the stream.  pending
+// reports whether r.hdr holds the header of a stream identifier that began
+// the next member.  endMember returns io.EOF unless r's trailer mode requires
+// otherwise.
+func (r *Reader) endMember(pending bool) error {
+	r.memberEnd = true
+	r.pendingHeader = pending
+	switch r.trailerMode {
+	case TrailerError:
+		if pending {
+			return r.corrupt(ErrTrailingData)
+		}
+		var b [1]byte
+		n, err := io.ReadFull(r.reader, b[:])
+		if n > 0 {
+			return r.corrupt(ErrTrailingData)
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+	case TrailerExpose:
+		var trailer []byte
+		if pending {
+			trailer = append(trailer, r.hdr...)
+			r.pendingHeader = false
+		}
+		limit := int64(MaxTrailerLen - len(trailer) + 1)
+		rest, err := ioutil.ReadAll(io.LimitReader(r.reader, limit))
+		if err != nil {
+			return err
+		}
+		if len(trailer)+len(rest) > MaxTrailerLen {
+			return r.corrupt(ErrTrailerTooLarge)
+		}
+		if len(trailer)+len(rest) > 0 {
+			r.trailer = append(trailer, rest...)
+		}
+	}
+	return io.EOF
+}
@@ -0,0 +1,120 @@
+package snappystream
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+// This test checks each trailer mode with a garbage byte following a stream
+// ended by a terminal marker, and with a second stream following the first.
+func TestReaderTrailers(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithTerminalMarker())
+	_, err := w.Write([]byte("single member"))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	member := buf.Bytes()
+	garbage := append(append([]byte{}, member...), 0xaa)
+	concatenated := append(append([]byte{}, member...), member...)
+
+	read := func(stream []byte, mode TrailerMode) (*Reader, error) {
+		r := NewReader(bytes.NewReader(stream), true, Trailers(mode))
+		r.Multistream(false)
+		b, err := ioutil.ReadAll(r)
+		if err == nil && string(b) != "single member" {
+			t.Fatalf("mode %d: decoded %q", mode, b)
+		}
+		return r, err
+	}
+
+	for _, stream := range [][]byte{member, garbage, concatenated} {
+		r, err := read(stream, TrailerIgnore)
+		if err != nil || r.Trailer() != nil {
+			t.Errorf("ignore %x: trailer %x (%v)", stream, r.Trailer(), err)
+		}
+	}
+
+	_, err = read(member, TrailerError)
+	if err != nil {
+		t.Errorf("error without trailer: %v", err)
+	}
+	for _, stream := range [][]byte{garbage, concatenated} {
+		_, err = read(stream, TrailerError)
+		if !errors.Is(err, ErrTrailingData) {
+			t.Errorf("error %x: unexpected error %v", stream, err)
+		}
+	}
+
+	for _, test := range []struct {
+		stream  []byte
+		trailer []byte
+	}{
+		{member, nil},
+		{garbage, []byte{0xaa}},
+		{concatenated, member},
+	} {
+		r, err := read(test.stream, TrailerExpose)
+		if err != nil || !bytes.Equal(r.Trailer(), test.trailer) {
+			t.Errorf("expose %x: trailer %x (%v)", test.stream, r.Trailer(), err)
+		}
+	}
+
+	// by default the garbage byte is read as a truncated chunk header.
+	_, err = read(garbage, TrailerLenient)
+	if err == nil {
+		t.Errorf("lenient read succeeded with trailing garbage")
+	}
+}
+
+// This test checks that a chunk of the terminal marker's type that is not
+// empty is skipped rather than ending the stream.
+func TestReaderForeignTerminalChunk(t *testing.T) {
+	stream := bytes.Join([][]byte{
+		streamID,
+		compressedChunk(t, []byte("before ")),
+		opaqueChunk(chunkTerminal, 10),
+		compressedChunk(t, []byte("after")),
+	}, nil)
+	for _, mode := range []TrailerMode{TrailerLenient, TrailerIgnore, TrailerError, TrailerExpose} {
+		r := NewReader(bytes.NewReader(stream), true, Trailers(mode))
+		r.Multistream(false)
+		b, err := ioutil.ReadAll(r)
+		if err != nil || string(b) != "before after" {
+			t.Errorf("mode %d: read %q (%v)", mode, b, err)
+		}
+		if r.GracefulEOF() {
+			t.Errorf("mode %d: graceful end of stream", mode)
+		}
+	}
+}
+
+// This test checks that TrailerExpose reads at most MaxTrailerLen bytes of
+// trailing data.
+func TestReaderTrailerTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithTerminalMarker())
+	err := w.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	n := buf.Len()
+	for _, size := range []int{MaxTrailerLen, MaxTrailerLen + 1} {
+		stream := append(append([]byte{}, buf.Bytes()[:n]...), make([]byte, size)...)
+		r := NewReader(bytes.NewReader(stream), true, Trailers(TrailerExpose))
+		r.Multistream(false)
+		_, err = ioutil.ReadAll(r)
+		if size == MaxTrailerLen && (err != nil || len(r.Trailer()) != size) {
+			t.Errorf("trailer of %d bytes: read %d (%v)", size, len(r.Trailer()), err)
+		}
+		if size > MaxTrailerLen && !errors.Is(err, ErrTrailerTooLarge) {
+			t.Errorf("trailer of %d bytes: unexpected error %v", size, err)
+		}
+	}
+}
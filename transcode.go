@@ -0,0 +1,33 @@
+package snappystream
+
+import (
+	"io"
+)
+
+// Transcode decodes src using decode and writes the result to dst encoded as
+// a snappy framed stream.  Data is buffered so that full blocks are emitted
+// regardless of how decode's reader returns data.  If the reader returned by
+// decode is an io.Closer it is closed after copying.  Transcode finalizes the
+// framed stream but makes no attempt to close dst.
+//
+// The first error encountered decoding, encoding, or closing is returned.
+func Transcode(dst io.Writer, src io.Reader, decode func(io.Reader) (io.Reader, error)) error {
+	r, err := decode(src)
+	if err != nil {
+		return err
+	}
+
+	w := NewBufferedWriter(dst)
+	_, err = io.Copy(w, r)
+	if err == nil {
+		err = w.Close()
+	}
+
+	if c, ok := r.(io.Closer); ok {
+		cerr := c.Close()
+		if err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package snappystream
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"testing"
+)
+
+func ExampleTranscode() {
+	// gzipped holds a gzip archive to be converted.
+	var gzipped bytes.Buffer
+	gw := gzip.NewWriter(&gzipped)
+	io.WriteString(gw, "hello transcoding")
+	gw.Close()
+
+	var sz bytes.Buffer
+	err := Transcode(&sz, &gzipped, func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	b, err := ioutil.ReadAll(NewReader(&sz, VerifyChecksum))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(b))
+	// Output: hello transcoding
+}
+
+// This test checks that Transcode reports decoding errors.
+func TestTranscode_errors(t *testing.T) {
+	var sz bytes.Buffer
+	err := Transcode(&sz, bytes.NewReader([]byte("not gzip")), func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	})
+	if err == nil {
+		t.Fatalf("expected error for invalid gzip header")
+	}
+
+	// a truncated gzip archive fails while copying.
+	var gzipped bytes.Buffer
+	gw := gzip.NewWriter(&gzipped)
+	gw.Write(testDataMan)
+	gw.Close()
+	truncated := gzipped.Bytes()[:gzipped.Len()/2]
+	err = Transcode(&sz, bytes.NewReader(truncated), func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	})
+	if err == nil {
+		t.Fatalf("expected error for truncated gzip data")
+	}
+
+	// errors writing to dst are reported.
+	err = Transcode(unwritable(fmt.Errorf("cannot write")), bytes.NewReader(testDataMan), func(r io.Reader) (io.Reader, error) {
+		return r, nil
+	})
+	if err == nil {
+		t.Fatalf("expected error writing to dst")
+	}
+}
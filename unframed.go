@@ -0,0 +1,198 @@
+package snappystream
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/mreiferson/go-snappystream/snappy-go"
+)
+
+// maxRawBlockSize is the largest decoded length accepted for a raw
+// (unframed) snappy block.  Raw blocks carry no framing limits of their own so
+// this bound protects against allocating memory for hostile length headers.
+const maxRawBlockSize = 1 << 26
+
+// NewUnframedReader returns an io.Reader that decodes a sequence of
+// concatenated raw snappy blocks, such as those produced by repeated calls to
+// snappy.Encode, which carry no stream identifier or checksums.  It is
+// intended to help migrate data written without framing.
+//
+// The beginning of r is inspected to determine its format.  If r is already a
+// snappy framed stream it is decoded by a Reader verifying checksums according
+// to verifyChecksum.  If r begins with neither a stream identifier nor a
+// plausible raw snappy block ErrNotSnappy is returned.
+func NewUnframedReader(r io.Reader, verifyChecksum bool) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	p, err := br.Peek(len(streamID))
+	if bytes.Equal(p, streamID) {
+		return NewReader(br, verifyChecksum), nil
+	}
+	if len(p) == 0 {
+		if err == io.EOF {
+			return &unframedReader{r: br}, nil
+		}
+		return nil, err
+	}
+
+	// a raw block begins with a varint-encoded length and, unless empty, a
+	// literal (a copy cannot precede any decoded data).
+	declen, n := binary.Uvarint(p)
+	if n <= 0 || declen > maxRawBlockSize || (declen > 0 && n < len(p) && p[n]&0x03 != tagLiteral) {
+		return nil, ErrNotSnappy
+	}
+
+	return &unframedReader{r: br}, nil
+}
+
+// snappy element tags, as defined by the unexported constants of
+// snappy-go/snappy.go.
+const (
+	tagLiteral = 0x00
+	tagCopy1   = 0x01
+	tagCopy2   = 0x02
+	tagCopy4   = 0x03
+)
+
+// rawHeaderLen returns the length of the header of the element of a raw
+// snappy block beginning with tag.  The data of a literal follows its header.
+func rawHeaderLen(tag byte) int {
+	switch tag & 0x03 {
+	case tagLiteral:
+		if x := tag >> 2; x >= 60 {
+			return 1 + int(x-59)
+		}
+		return 1
+	case tagCopy1:
+		return 2
+	case tagCopy2:
+		return 3
+	}
+	return 5
+}
+
+// parseRawElement decodes h, the header of an element of a raw snappy block
+// of rawHeaderLen(h[0]) bytes, returning the number of bytes the element
+// decodes to and, for a copy, the offset copied from.
+func parseRawElement(h []byte) (length, offset uint64) {
+	tag := h[0]
+	switch tag & 0x03 {
+	case tagLiteral:
+		x := uint64(tag >> 2)
+		if x >= 60 {
+			x = 0
+			for i := len(h) - 1; i >= 1; i-- {
+				x = x<<8 | uint64(h[i])
+			}
+		}
+		return x + 1, 0
+	case tagCopy1:
+		return 4 + uint64(tag>>2)&0x07, uint64(tag&0xe0)<<3 | uint64(h[1])
+	case tagCopy2:
+		return 1 + uint64(tag>>2), uint64(binary.LittleEndian.Uint16(h[1:]))
+	}
+	return 1 + uint64(tag>>2), uint64(binary.LittleEndian.Uint32(h[1:]))
+}
+
+// unframedReader decodes concatenated raw snappy blocks.
+type unframedReader struct {
+	r   *bufio.Reader
+	err error
+
+	enc []byte // encoded bytes of the current block
+	dst []byte // decoded bytes of the current block
+	buf []byte // unread decoded bytes
+}
+
+func (r *unframedReader) Read(b []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.buf, r.err = r.nextBlock()
+	}
+
+	n := copy(b, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// nextBlock reads the next raw snappy block from the source by walking its
+// chunk tags to find the end of the block, then decodes it.
+func (r *unframedReader) nextBlock() ([]byte, error) {
+	r.enc = r.enc[:0]
+
+	// the block begins with its varint-encoded decoded length.
+	var declen uint64
+	for shift := uint(0); ; shift += 7 {
+		c, err := r.r.ReadByte()
+		if err == io.EOF && len(r.enc) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		r.enc = append(r.enc, c)
+		if shift > 63 {
+			return nil, snappy.ErrCorrupt
+		}
+		declen |= uint64(c&0x7f) << shift
+		if c < 0x80 {
+			break
+		}
+	}
+	if declen > maxRawBlockSize {
+		return nil, fmt.Errorf("raw block data too large %d > %d", declen, maxRawBlockSize)
+	}
+
+	for d := uint64(0); d < declen; {
+		p, err := r.readN(1)
+		if err != nil {
+			return nil, err
+		}
+		tag, n := p[0], rawHeaderLen(p[0])
+		if n > 1 {
+			_, err = r.readN(n - 1)
+			if err != nil {
+				return nil, err
+			}
+		}
+		length, _ := parseRawElement(r.enc[len(r.enc)-n:])
+		if tag&0x03 == tagLiteral {
+			if d+length > declen {
+				return nil, snappy.ErrCorrupt
+			}
+			_, err = r.readN(int(length))
+			if err != nil {
+				return nil, err
+			}
+		}
+		d += length
+	}
+
+	var err error
+	r.dst, err = snappy.Decode(r.dst[:cap(r.dst)], r.enc)
+	if err != nil {
+		return nil, err
+	}
+	return r.dst, nil
+}
+
+// readN reads n bytes from the source, appending them to r.enc, and returns
+// them.
+func (r *unframedReader) readN(n int) ([]byte, error) {
+	start := len(r.enc)
+	if cap(r.enc)-start < n {
+		enc := make([]byte, start, 2*cap(r.enc)+n)
+		copy(enc, r.enc)
+		r.enc = enc
+	}
+	r.enc = r.enc[:start+n]
+	_, err := noeof(io.ReadFull(r.r, r.enc[start:]))
+	if err != nil {
+		return nil, err
+	}
+	return r.enc[start:], nil
+}
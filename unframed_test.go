@@ -0,0 +1,82 @@
+package snappystream
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/mreiferson/go-snappystream/snappy-go"
+)
+
+// This test checks that concatenated raw snappy blocks are decoded.
+func TestUnframedReader(t *testing.T) {
+	var raw []byte
+	var want []byte
+	for _, p := range [][]byte{
+		testDataMan,
+		[]byte("a short block"),
+		nil,
+		make([]byte, 100000),
+		testDataJSON,
+	} {
+		enc, err := snappy.Encode(nil, p)
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		raw = append(raw, enc...)
+		want = append(want, p...)
+	}
+
+	r, err := NewUnframedReader(bytes.NewReader(raw), true)
+	if err != nil {
+		t.Fatalf("reader: %v", err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(b, want) {
+		t.Fatalf("unequal decompressed content")
+	}
+
+	// truncated raw input is corrupt.
+	r, err = NewUnframedReader(bytes.NewReader(raw[:len(raw)-1]), true)
+	if err != nil {
+		t.Fatalf("reader: %v", err)
+	}
+	_, err = ioutil.ReadAll(r)
+	if err == nil {
+		t.Fatalf("read: expected error for truncated input")
+	}
+}
+
+// This test checks that framed input passes through NewUnframedReader and
+// that input in neither format is rejected.
+func TestUnframedReader_detect(t *testing.T) {
+	msg := "already framed"
+	r, err := NewUnframedReader(encodedString(msg), true)
+	if err != nil {
+		t.Fatalf("reader: %v", err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(b) != msg {
+		t.Fatalf("read: %q", b)
+	}
+
+	r, err = NewUnframedReader(bytes.NewReader(nil), true)
+	if err != nil {
+		t.Fatalf("empty reader: %v", err)
+	}
+	b, err = ioutil.ReadAll(r)
+	if err != nil || len(b) != 0 {
+		t.Fatalf("empty read: %q %v", b, err)
+	}
+
+	_, err = NewUnframedReader(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}), true)
+	if err != ErrNotSnappy {
+		t.Fatalf("garbage: %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package snappystream
+
+// WithVersion causes a Writer to record v, the version of the application's
+// format, in a one-byte skippable chunk following the stream identifier.  The
+// chunk is written once, together with the stream identifier, so a Writer
+// that never writes the identifier (see WithHeaderOnEmpty and NewAppender)
+// records no version.  Readers report the version with Reader.Version and
+// otherwise ignore it.
+func WithVersion(v byte) WriterOption {
+	return func(w *Writer) {
+		w.version = v
+		w.hasVersion = true
+	}
+}
+
+// writeVersion writes the chunk recording the format version.
+func (w *Writer) writeVersion() error {
+	return w.writeAll([]byte{chunkVersion, 1, 0, 0, w.version})
+}
+
+// Version returns the format version recorded by a Writer created with
+// WithVersion, and true, once r has read the chunk recording it.  The chunk
+// precedes all data blocks so it is available once the first Read has
+// returned.  Version returns false if the stream carries no version or none
+// has been read yet.
+func (r *Reader) Version() (byte, bool) {
+	return r.version, r.hasVersion
+}
+
+// readVersion reads the chunk recording the format version.  Chunks of the
+// same type that do not hold exactly one byte were not written by WithVersion
+// and are skipped like any other skippable chunk, however long.
+func (r *Reader) readVersion() error {
+	buf, ok, err := r.readOptional(1)
+	if err != nil {
+		return err
+	}
+	if ok && len(buf) == 1 {
+		r.version = buf[0]
+		r.hasVersion = true
+	}
+	return nil
+}
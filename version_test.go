@@ -0,0 +1,68 @@
+package snappystream
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+// This test checks that the version is written exactly once after the stream
+// identifier and reported by a Reader.
+func TestVersion(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithVersion(3))
+	for i := 0; i < 3; i++ {
+		_, err := w.Write([]byte("versioned"))
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	err := w.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	chunk := []byte{chunkVersion, 1, 0, 0, 3}
+	if !bytes.HasPrefix(buf.Bytes()[len(streamID):], chunk) || bytes.Count(buf.Bytes(), chunk) != 1 {
+		t.Fatalf("version chunk not written once after stream identifier: %x", buf.Bytes())
+	}
+
+	r := NewReader(bytes.NewReader(buf.Bytes()), true)
+	if _, ok := r.Version(); ok {
+		t.Fatalf("version before reading")
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(b) != "versionedversionedversioned" {
+		t.Fatalf("decoded %q", b)
+	}
+	if v, ok := r.Version(); !ok || v != 3 {
+		t.Fatalf("version %d, %v", v, ok)
+	}
+
+	// no version is written without the stream identifier.
+	buf.Reset()
+	w = NewWriter(&buf, WithVersion(3), WithHeaderOnEmpty(false))
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("empty stream %x", buf.Bytes())
+	}
+
+	// a chunk of the same type but another length is skipped.
+	for _, chunk := range [][]byte{{chunkVersion, 2, 0, 0, 3, 4}, opaqueChunk(chunkVersion, 100000)} {
+		stream := append(append([]byte{}, streamID...), chunk...)
+		stream = append(stream, uncompressedChunk(t, []byte("data"))...)
+		r = NewReader(bytes.NewReader(stream), true)
+		b, err = ioutil.ReadAll(r)
+		if err != nil || string(b) != "data" {
+			t.Fatalf("read %q (%v)", b, err)
+		}
+		if _, ok := r.Version(); ok {
+			t.Fatalf("version from chunk of length %d", len(chunk)-4)
+		}
+	}
+}
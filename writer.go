@@ -4,13 +4,36 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"hash"
 	"hash/crc32"
 	"io"
-
-	"github.com/mreiferson/go-snappystream/snappy-go"
+	"sync"
+	"time"
 )
 
-var errClosed = fmt.Errorf("closed")
+// ErrWriterClosed is returned by the methods of a Writer or BufferedWriter
+// called after it has been closed.
+var ErrWriterClosed = errors.New("writer closed")
+
+// ErrRecordTooLarge matches, using errors.Is, any *RecordTooLargeError.
+var ErrRecordTooLarge = errors.New("record too large")
+
+// RecordTooLargeError is returned by Writer.WriteBlock and Writer.WriteRecord
+// when the data does not fit in a single block.  Limit is MaxBlockSize unless
+// the Writer was created with WithMaxBufferSize.
+type RecordTooLargeError struct {
+	Length int // length of the record
+	Limit  int // largest length allowed
+}
+
+func (e *RecordTooLargeError) Error() string {
+	return fmt.Sprintf("record too large %d > %d", e.Length, e.Limit)
+}
+
+// Is reports whether target is ErrRecordTooLarge.
+func (e *RecordTooLargeError) Is(target error) bool {
+	return target == ErrRecordTooLarge
+}
 
 // BufferedWriter is an io.WriteCloser with behavior similar to writers
 // returned by NewWriter but it buffers written data, maximizing block size (to
@@ -25,21 +48,33 @@ var errClosed = fmt.Errorf("closed")
 // NOTE: BufferedWriter cannot be instantiated via struct literal and must
 // use NewBufferedWriter (i.e. its zero value is not usable).
 type BufferedWriter struct {
+	mu  sync.Mutex // guards against concurrent automatic flushes
 	err error
-	w   *writer
+	w   *Writer
 	bw  *bufio.Writer
+
+	flushDelay time.Duration
+	flushTimer *time.Timer
+
+	committed    int64 // committed offset of w once closed
+	committedLen int64 // committed length of w once closed
 }
 
 // NewBufferedWriter allocates and returns a BufferedWriter with an internal
 // buffer of MaxBlockSize bytes.  If an error occurs writing a block to w, all
 // future writes will fail with the same error.  After all data has been
 // written, the client should call the Flush method to guarantee all data has
-// been forwarded to the underlying io.Writer.
-func NewBufferedWriter(w io.Writer) *BufferedWriter {
-	_w := NewWriter(w).(*writer)
+// been forwarded to the underlying io.Writer.  The options opts are applied to
+// the Writer that encodes buffered blocks.
+func NewBufferedWriter(w io.Writer, opts ...WriterOption) *BufferedWriter {
+	_w := NewWriter(w, opts...)
+	size := MaxBlockSize
+	if _w.deterministic || _w.maxBufferSize > 0 {
+		size = _w.blockSize
+	}
 	return &BufferedWriter{
 		w:  _w,
-		bw: bufio.NewWriterSize(_w, MaxBlockSize),
+		bw: bufio.NewWriterSize(_w, size),
 	}
 }
 
@@ -48,51 +83,184 @@ func NewBufferedWriter(w io.Writer) *BufferedWriter {
 // writer.  ReadFrom returns the number number of bytes read, along with any
 // error encountered (other than io.EOF).
 func (w *BufferedWriter) ReadFrom(r io.Reader) (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
 	if w.err != nil {
 		return 0, w.err
 	}
 
 	var n int64
 	n, w.err = w.bw.ReadFrom(r)
+	w.resetFlushTimer()
 	return n, w.err
 }
 
 // Write buffers p internally, encoding and writing a block to the underlying
-// buffer if the buffer grows beyond MaxBlockSize bytes.  The returned int
-// will be 0 if there was an error and len(p) otherwise.
+// buffer if the buffer grows beyond MaxBlockSize bytes.  If w was created with
+// WithMaxLatencyBlockSize and p is smaller than the threshold, the buffer is
+// flushed and p is written immediately as its own block instead.  An empty p
+// is a no-op and does not flush the buffer.  The returned int will be 0 if
+// there was an error and len(p) otherwise.
 func (w *BufferedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
 	if w.err != nil {
 		return 0, w.err
 	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if w.w.deterministic {
+		return w.writeFull(p)
+	}
+	if w.w.singleBlockWrites {
+		// the Writer rejects oversized writes, which bufio.Writer would
+		// pass straight through.
+		n, err := w.writeFull(p)
+		w.resetFlushTimer()
+		return n, err
+	}
+
+	if len(p) < w.w.latencyBlockSize {
+		// emit small writes immediately as their own block, after any data
+		// already buffered.
+		w.err = w.bw.Flush()
+		if w.err == nil {
+			_, w.err = w.w.Write(p)
+		}
+		if w.err != nil {
+			return 0, w.err
+		}
+		return len(p), nil
+	}
 
 	_, w.err = w.bw.Write(p)
 	if w.err != nil {
 		return 0, w.err
 	}
+	w.resetFlushTimer()
 
 	return len(p), nil
 }
 
+// writeFull buffers p, writing a block each time the buffer fills, for
+// writers created with WithDeterministicBlocks or WithSingleBlockWrites.
+// Unlike bufio.Writer.Write it never writes p directly when the buffer is
+// empty, which would end a block at the boundary of p or exceed the largest
+// block.  w.mu must be held.
+func (w *BufferedWriter) writeFull(p []byte) (int, error) {
+	for i := 0; i < len(p); {
+		if w.bw.Available() == 0 {
+			w.err = w.bw.Flush()
+			if w.err != nil {
+				return 0, w.err
+			}
+		}
+		n := w.bw.Available()
+		if n > len(p)-i {
+			n = len(p) - i
+		}
+		w.bw.Write(p[i : i+n])
+		i += n
+	}
+	return len(p), nil
+}
+
 // Flush encodes and writes a block with the contents of w's internal buffer to
 // the underlying writer even if the buffer does not contain a full block of
-// data (MaxBlockSize bytes).
+// data (MaxBlockSize bytes).  If w was created with WithDeterministicBlocks
+// Flush writes nothing and only reports any earlier error.
 func (w *BufferedWriter) Flush() error {
-	if w.err == nil {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err == nil && !w.w.deterministic {
 		w.err = w.bw.Flush()
 	}
 
 	return w.err
 }
 
-// Close flushes w's internal buffer and tears down internal data structures.
-// After a successful call to Close method calls on w return an error.  Close
-// makes no attempt to close the underlying writer.
+// finish writes the stream identifier, if it has not been written, and any
+// trailing chunks.
+func (w *Writer) finish() error {
+	err := w.writeStreamID()
+	if err != nil {
+		return err
+	}
+	if w.streamChecksum {
+		err = w.writeStreamChecksum()
+		if err != nil {
+			return err
+		}
+	}
+	if w.streamDigest != nil {
+		err = w.writeStreamDigest()
+		if err != nil {
+			return err
+		}
+	}
+	if w.totalLength >= 0 && w.committed != w.totalLength {
+		return &ExpectedLenError{Expected: w.totalLength, Decoded: w.committed}
+	}
+	if w.totalLengthTrailer {
+		err = w.writeTotalLength(w.committed)
+		if err != nil {
+			return err
+		}
+	}
+	if w.terminalMarker {
+		err = w.writeAll([]byte{chunkTerminal, 0, 0, 0})
+		if err != nil {
+			return err
+		}
+	}
+	if w.flushEachBlock {
+		return w.flushUnderlying()
+	}
+	return nil
+}
+
+// WriteHeader writes the stream identifier to the underlying writer if it has
+// not already been written.  See Writer.WriteHeader.
+func (w *BufferedWriter) WriteHeader() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return w.err
+	}
+
+	w.err = w.w.WriteHeader()
+	return w.err
+}
+
+// Close flushes w's internal buffer, finalizes the stream (see Writer.Close),
+// and tears down internal data structures.  After a successful call to Close
+// method calls on w return an error.  Close makes no attempt to close the
+// underlying writer unless w was created with WithCloseUnderlying.
 func (w *BufferedWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
 	if w.err != nil {
 		return w.err
 	}
 
+	if w.flushTimer != nil {
+		w.flushTimer.Stop()
+		w.flushTimer = nil
+	}
+
 	w.err = w.bw.Flush()
+	if w.err == nil {
+		w.err = w.w.Close()
+	}
+	w.committed = w.w.CommittedOffset()
+	w.committedLen = w.w.CommittedLen()
 	w.w = nil
 	w.bw = nil
 
@@ -100,21 +268,349 @@ func (w *BufferedWriter) Close() error {
 		return w.err
 	}
 
-	w.err = errClosed
+	w.err = ErrWriterClosed
+	return nil
+}
+
+// CommittedOffset returns the number of decoded bytes contained in blocks that
+// were successfully written to the underlying writer.  Buffered data is not
+// committed.  See Writer.CommittedOffset.
+func (w *BufferedWriter) CommittedOffset() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.w == nil {
+		return w.committed
+	}
+	return w.w.CommittedOffset()
+}
+
+// CommittedLen returns the length of the output of w up to the last block
+// counted by CommittedOffset.  See Writer.CommittedLen.
+func (w *BufferedWriter) CommittedLen() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.w == nil {
+		return w.committedLen
+	}
+	return w.w.CommittedLen()
+}
+
+// AutoFlush causes w to flush any buffered partial block after d has elapsed
+// without a call to Write or ReadFrom.  Automatic flushes happen in a
+// background goroutine and are serialized with w's other methods.  A
+// non-positive d disables automatic flushing.  The timer is stopped when w is
+// closed.
+func (w *BufferedWriter) AutoFlush(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.flushTimer != nil {
+		w.flushTimer.Stop()
+		w.flushTimer = nil
+	}
+	w.flushDelay = d
+	if d > 0 && w.err == nil {
+		w.flushTimer = time.AfterFunc(d, w.autoFlush)
+	}
+}
+
+// resetFlushTimer restarts the automatic flush timer, if any, following
+// activity on w.  w.mu must be held.
+func (w *BufferedWriter) resetFlushTimer() {
+	if w.flushTimer != nil {
+		w.flushTimer.Reset(w.flushDelay)
+	}
+}
+
+// autoFlush is called by the automatic flush timer.
+func (w *BufferedWriter) autoFlush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err == nil && !w.w.deterministic && w.bw.Buffered() > 0 {
+		w.err = w.bw.Flush()
+	}
+}
+
+// WriterOption configures optional behavior of a Writer.
+type WriterOption func(*Writer)
+
+// WithStreamChecksum causes a Writer to compute a checksum over all
+// uncompressed data written to the stream and emit it in a trailing skippable
+// chunk when the Writer is closed.  Readers ignore the trailer unless created
+// with the VerifyStreamChecksum option.
+func WithStreamChecksum() WriterOption {
+	return func(w *Writer) {
+		w.streamChecksum = true
+	}
+}
+
+// WithNoCompression causes a Writer to emit all data in uncompressed blocks
+// without attempting to compress it.  This saves CPU when data is known to be
+// incompressible (e.g. encrypted payloads).
+func WithNoCompression() WriterOption {
+	return func(w *Writer) {
+		w.noCompression = true
+	}
+}
+
+// WithMinCompressionRatio causes a Writer to keep a compressed block only if
+// its encoded length is less than r times the length of the data, emitting the
+// data in an uncompressed block otherwise.  Readers then avoid the cost of
+// decoding blocks that compress only marginally.  For example, an r of 0.9
+// requires compression to save at least 10%.  The default r of 1 stores data
+// uncompressed only when compression does not shorten it, and larger values
+// are treated as 1.
+func WithMinCompressionRatio(r float64) WriterOption {
+	return func(w *Writer) {
+		if r > 1 {
+			r = 1
+		}
+		w.minRatio = r
+	}
+}
+
+// WithCloseUnderlying causes a Writer's Close method to close the underlying
+// writer, if it is an io.Closer, after the stream has been finalized.
+func WithCloseUnderlying() WriterOption {
+	return func(w *Writer) {
+		w.closeUnderlying = true
+	}
+}
+
+// WithMaxLatencyBlockSize causes a BufferedWriter to emit writes smaller
+// than n bytes immediately as their own block rather than buffering them,
+// avoiding latency for small interactive writes while larger writes are still
+// buffered into full MaxBlockSize blocks.  Any data already buffered is flushed
+// first, so that the order of writes is preserved.  A Writer emits every write
+// immediately and is unaffected by this option.
+func WithMaxLatencyBlockSize(n int) WriterOption {
+	return func(w *Writer) {
+		w.latencyBlockSize = n
+	}
+}
+
+// WithDeterministicBlocks causes a BufferedWriter to divide its input into
+// blocks of exactly n bytes, emitting a block only once it is full, so that
+// the encoded stream depends solely on the data written and n and not on how
+// the data was divided among calls to Write and ReadFrom.  Only the final
+// block, written by Close, may be shorter.  In this mode Flush and AutoFlush
+// do not write partial blocks, and WithMaxLatencyBlockSize and
+// WithAdaptiveBlockSize have no effect.  A non-positive n or one greater than
+// MaxBlockSize selects MaxBlockSize.
+func WithDeterministicBlocks(n int) WriterOption {
+	return func(w *Writer) {
+		if n <= 0 || n > MaxBlockSize {
+			n = MaxBlockSize
+		}
+		w.deterministic = true
+		w.blockSize = n
+	}
+}
+
+// WithResyncInterval causes a Writer to repeat the stream identifier before
+// the first data block that follows n or more bytes of output since the
+// previous identifier.  A reader joining the stream part way through can then
+// begin decoding at the next identifier (see NewResyncReader).  Conformant
+// readers ignore the repeated identifiers.  A non-positive n disables
+// resynchronization points, which is the default.  WithResyncInterval cannot
+// be combined with WithTotalLengthHeader or WithTotalLengthTrailer.
+func WithResyncInterval(n int) WriterOption {
+	return func(w *Writer) {
+		w.resyncInterval = int64(n)
+	}
+}
+
+// WithPreallocatedDst causes a Writer to allocate its encoding buffer at the
+// worst-case encoded size of a MaxBlockSize block when it is created, rather
+// than growing it as larger blocks are written.  Memory use is then fixed up
+// front and writes in steady state do not allocate.
+func WithPreallocatedDst() WriterOption {
+	return func(w *Writer) {
+		w.preallocDst = true
+	}
+}
+
+// WithTerminalMarker causes a Writer to emit an empty skippable chunk marking
+// the completion of the stream as the last chunk written by Close.  A Reader
+// reports whether the marker was seen with GracefulEOF, distinguishing a
+// properly finished stream from a truncated one over transports where the end
+// of input is ambiguous.  Readers otherwise ignore the marker.
+func WithTerminalMarker() WriterOption {
+	return func(w *Writer) {
+		w.terminalMarker = true
+	}
+}
+
+// WithFlushEachBlock causes a Writer to flush the underlying writer after
+// writing each data block, and after finishing the stream in Close, if the
+// underlying writer has a Flush method with the signature of either
+// http.Flusher or bufio.Writer.  Each block is then delivered promptly when
+// streaming through a buffered writer, such as an http.ResponseWriter pushing
+// data to a client.
+func WithFlushEachBlock() WriterOption {
+	return func(w *Writer) {
+		w.flushEachBlock = true
+	}
+}
+
+// flushUnderlying flushes the underlying writer if it supports flushing.
+func (w *Writer) flushUnderlying() error {
+	switch f := w.writer.(type) {
+	case interface{ Flush() error }:
+		if err := f.Flush(); err != nil {
+			return fmt.Errorf("flushing stream: %w", err)
+		}
+	case interface{ Flush() }:
+		f.Flush()
+	}
 	return nil
 }
 
-type writer struct {
+// WithSingleBlockWrites causes each call to a Writer's Write method to write
+// exactly one block, like WriteBlock, so that every Write is delivered as one
+// message by Reader.ReadMessage.  Writes of more than MaxBlockSize bytes are
+// rejected with a *RecordTooLargeError, leaving the stream unmodified, rather
+// than divided into several blocks, and an empty write produces an empty
+// block.
+// WithAdaptiveBlockSize has no effect in this mode.  A BufferedWriter
+// coalesces writes before they reach its Writer and divides them into blocks
+// of at most MaxBlockSize bytes, so this option does not preserve the
+// boundaries of writes to a BufferedWriter, nor does it limit their size.
+func WithSingleBlockWrites() WriterOption {
+	return func(w *Writer) {
+		w.singleBlockWrites = true
+	}
+}
+
+// WithMutex causes a Writer to serialize calls to its methods internally,
+// making it safe for concurrent use.  Each call to Write then writes whole
+// blocks to the underlying writer without interleaving with other calls.
+func WithMutex() WriterOption {
+	return func(w *Writer) {
+		w.mu = &sync.Mutex{}
+	}
+}
+
+// WithHeaderOnEmpty controls whether closing a Writer to which nothing was
+// written emits a stream identifier.  By default it does, so that the output
+// is always a valid (empty) snappy framed stream and is recognizable as such.
+// If ok is false, closing an unused Writer writes nothing at all, and its
+// output is indistinguishable from an empty file.  Trailing chunks, like the
+// stream checksum, are then also omitted.  An explicit call to WriteHeader
+// writes the stream identifier regardless of this option.
+func WithHeaderOnEmpty(ok bool) WriterOption {
+	return func(w *Writer) {
+		w.headerOnEmpty = ok
+	}
+}
+
+// WithAppHeader causes a Writer to emit a skippable chunk carrying data
+// immediately after the stream identifier, ahead of any data blocks.  The
+// header is exposed by Reader.AppHeader and can be inspected by tools without
+// decompressing the stream.  data must not exceed MaxBlockSize bytes or all
+// writes to the Writer fail.
+func WithAppHeader(data []byte) WriterOption {
+	return func(w *Writer) {
+		if len(data) > MaxBlockSize {
+			w.err = fmt.Errorf("app header too large %d > %d", len(data), MaxBlockSize)
+			return
+		}
+		w.appHeader = append([]byte{}, data...)
+	}
+}
+
+// Writer is an io.WriteCloser that encodes its input as a snappy framed
+// stream.  Writer cannot be instantiated via struct literal and must use
+// NewWriter.  A Writer is not safe for concurrent use unless it was created
+// with WithMutex.
+type Writer struct {
+	mu     *sync.Mutex // non-nil if created with WithMutex
 	writer io.Writer
 	err    error
 
 	hdr []byte
 	dst []byte
 
-	sentStreamID bool
+	sentStreamID  bool
+	headerOnEmpty bool
+	appHeader     []byte // written after the stream identifier if non-nil
+
+	codec    Codec
+	level    int // see WithLevel
+	hasLevel bool
+
+	crcTable     *crc32.Table // see WithCRCTable
+	checksumMask uint32       // see WithChecksumMask
+
+	closeUnderlying bool
+	noCompression   bool
+
+	minRatio float64 // see WithMinCompressionRatio
+
+	latencyBlockSize int // see WithMaxLatencyBlockSize
+
+	resyncInterval int64 // see WithResyncInterval
+	sinceResync    int64 // bytes written since the last stream identifier
+
+	committed    int64 // decoded bytes in blocks written to writer
+	committedLen int64 // bytes written to writer up to the last such block
+	written      int64 // bytes written to writer
+
+	lastRatio float64 // ratio of the most recent block
+	avgRatio  float64 // moving average of block ratios
+
+	streamChecksum bool
+	streamCRC      uint32 // crc32c of all uncompressed data written
+
+	streamDigest hash.Hash // digest of all uncompressed data written, if non-nil
+
+	terminalMarker bool
+
+	blockLengthSidecar bool // see WithBlockLengthSidecar
+
+	adaptive  bool // see WithAdaptiveBlockSize
+	blockSize int  // size of the blocks into which Write divides its input
+	maxBlock  int  // largest block written, MaxBlockSize unless limited
+
+	preallocDst   bool // see WithPreallocatedDst
+	maxBufferSize int  // see WithMaxBufferSize, 0 if unlimited
+
+	flushEachBlock bool // see WithFlushEachBlock
+
+	singleBlockWrites bool // see WithSingleBlockWrites
+
+	deterministic bool // see WithDeterministicBlocks
+
+	totalLength        int64 // see WithTotalLengthHeader, -1 if not declared
+	totalLengthTrailer bool  // see WithTotalLengthTrailer
+
+	version    byte // see WithVersion
+	hasVersion bool
+}
+
+// FramedLenUpperBound returns an upper bound on the length of the snappy
+// framed stream produced by encoding n bytes, for sizing buffers or a
+// Content-Length before compressing.  The actual length depends on the data
+// and is usually much smaller.
+//
+// The bound counts the stream identifier and one block per MaxBlockSize bytes
+// of input, as produced by a single call to Writer.Write or by a
+// BufferedWriter that is not flushed early.  Blocks never exceed their
+// uncompressed size because a Writer stores incompressible data uncompressed.
+// Optional chunks, such as stream checksum trailers and app headers, are not
+// included.  Nor are the extra block headers written when blocks are smaller
+// than MaxBlockSize, as with WithAdaptiveBlockSize or WithMaxBufferSize, or
+// the repeated stream identifiers written by WithResyncInterval, so output
+// from a Writer so configured may exceed the bound.
+func FramedLenUpperBound(n int) int {
+	blocks := (n + MaxBlockSize - 1) / MaxBlockSize
+	return len(streamID) + blocks*8 + n
 }
 
-// NewWriter returns an io.Writer that writes its input to an underlying
+// NewWriter returns a Writer that writes its input to an underlying
 // io.Writer encoded as a snappy framed stream.  A stream identifier block is
 // written to w preceding the first data block.  The returned writer will never
 // emit a block with length in bytes greater than MaxBlockSize+4 nor one
@@ -124,25 +620,282 @@ type writer struct {
 // regardless of the length of *compressed* bytes written to the wrapped
 // io.Writer.  If the returned length is 0 then error will be non-nil.  If
 // len(p) exceeds 65536, the slice will be automatically chunked into smaller
-// blocks which are all emitted before the call returns.
-func NewWriter(w io.Writer) io.Writer {
-	return &writer{
+// blocks which are all emitted before the call returns.  Each Write emits at
+// least one block, so a sequence of small writes is better served by a
+// BufferedWriter, which coalesces them into full blocks (see
+// BenchmarkBufferedWriterSmallWrites).
+func NewWriter(w io.Writer, opts ...WriterOption) *Writer {
+	_w := &Writer{
 		writer: w,
+		codec:  DefaultCodec,
+
+		crcTable:     crcTable,
+		checksumMask: DefaultChecksumMask,
+
+		headerOnEmpty: true,
+		minRatio:      1,
+		blockSize:     MaxBlockSize,
+		maxBlock:      MaxBlockSize,
+		totalLength:   -1,
 
 		hdr: make([]byte, 8),
-		dst: make([]byte, 4096),
 	}
+	for _, opt := range opts {
+		opt(_w)
+	}
+	if _w.resyncInterval > 0 && (_w.totalLength >= 0 || _w.totalLengthTrailer) && _w.err == nil {
+		_w.err = errors.New("total length cannot be recorded with WithResyncInterval")
+	}
+	if _w.blockSize > _w.maxBlock {
+		_w.blockSize = _w.maxBlock
+	}
+
+	// the encoding buffer is allocated once options have determined the
+	// largest block.
+	size := 4096
+	if _w.preallocDst || size > _w.maxDstSize() {
+		size = _w.maxDstSize()
+	}
+	_w.dst = make([]byte, size)
+	return _w
+}
+
+// NewAppender returns a Writer that continues a snappy framed stream already
+// written to w, such as a file opened for appending.  Unlike NewWriter it does
+// not write a stream identifier, so repeatedly opening, appending to and
+// closing a file produces one continuous stream.  To delimit the appended data
+// with a fresh identifier use NewWriter instead, since readers skip repeated
+// identifiers.  WithAppHeader and WithVersion have no effect on the returned
+// Writer.
+func NewAppender(w io.Writer, opts ...WriterOption) *Writer {
+	_w := NewWriter(w, opts...)
+	_w.sentStreamID = true
+	return _w
 }
 
-func (w *writer) Write(p []byte) (int, error) {
+// Close finalizes the stream.  The stream identifier is written if it has not
+// been already, so that the output is a valid stream even if nothing was
+// written (unless w was created with WithHeaderOnEmpty(false)).  It is followed
+// by a stream checksum trailer if w was created with WithStreamChecksum, a
+// stream digest trailer if w was created with WithStreamDigest, and a terminal
+// marker if w was created with WithTerminalMarker.  After a successful call to
+// Close method calls on w return an error.
+//
+// Close does not close the underlying writer, even if it is an io.Closer,
+// unless w was created with WithCloseUnderlying.
+func (w *Writer) Close() error {
+	if w.mu != nil {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+	}
+
+	if w.err != nil {
+		return w.err
+	}
+
+	if w.sentStreamID || w.headerOnEmpty {
+		w.err = w.finish()
+		if w.err != nil {
+			return w.err
+		}
+	}
+
+	if c, ok := w.writer.(io.Closer); ok && w.closeUnderlying {
+		if err := c.Close(); err != nil {
+			w.err = fmt.Errorf("closing stream: %w", err)
+			return w.err
+		}
+	}
+
+	w.err = ErrWriterClosed
+	return nil
+}
+
+// WriteHeader writes the stream identifier to the underlying writer
+// immediately instead of waiting for the first data block.  This is useful
+// for protocols in which the receiver waits for the stream identifier before
+// any data is ready.  The stream identifier is written at most once;
+// WriteHeader is a no-op if it has already been written.
+func (w *Writer) WriteHeader() error {
+	if w.mu != nil {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+	}
+
+	if w.err != nil {
+		return w.err
+	}
+
+	w.err = w.writeStreamID()
+	return w.err
+}
+
+// writeStreamChecksum writes a skippable chunk containing the masked crc32c
+// of all uncompressed data written to w.
+func (w *Writer) writeStreamChecksum() error {
+	checksum := maskChecksum(w.streamCRC)
+	chunk := []byte{
+		chunkStreamChecksum, 4, 0, 0,
+		byte(checksum), byte(checksum >> 8), byte(checksum >> 16), byte(checksum >> 24),
+	}
+	return w.writeAll(chunk)
+}
+
+// encode encodes p with w's codec, at w's level if one was given and the
+// codec supports levels.
+func (w *Writer) encode(dst, p []byte) ([]byte, error) {
+	if lc, ok := w.codec.(LevelCodec); ok && w.hasLevel {
+		return lc.EncodeLevel(dst, p, w.level)
+	}
+	return w.codec.Encode(dst, p)
+}
+
+// writeAll writes p to the underlying writer.  A short write is reported as
+// io.ErrShortWrite even if the underlying writer returned no error, so that
+// a misbehaving writer cannot silently corrupt the stream.  Errors returned
+// by the underlying writer are wrapped, keeping their cause available to
+// errors.Is and errors.As.
+func (w *Writer) writeAll(p []byte) error {
+	n, err := w.writer.Write(p)
+	w.written += int64(n)
+	if err != nil {
+		return fmt.Errorf("writing stream: %w", err)
+	}
+	if n < len(p) {
+		return io.ErrShortWrite
+	}
+	return nil
+}
+
+// writeStreamID writes the stream identifier to the underlying writer if it
+// has not already been written.
+func (w *Writer) writeStreamID() error {
+	if w.sentStreamID {
+		return nil
+	}
+	err := w.writeAll(streamID)
+	if err != nil {
+		return err
+	}
+	if w.appHeader != nil {
+		err = w.writeAppHeader()
+		if err != nil {
+			return err
+		}
+	}
+	if w.hasVersion {
+		err = w.writeVersion()
+		if err != nil {
+			return err
+		}
+	}
+	if w.totalLength >= 0 {
+		err = w.writeTotalLength(w.totalLength)
+		if err != nil {
+			return err
+		}
+	}
+	w.sentStreamID = true
+	return nil
+}
+
+// writeAppHeader writes a skippable chunk containing the application header.
+func (w *Writer) writeAppHeader() error {
+	n := len(w.appHeader)
+	chunk := make([]byte, 4, 4+n)
+	chunk[0] = chunkAppHeader
+	chunk[1] = byte(n)
+	chunk[2] = byte(n >> 8)
+	chunk[3] = byte(n >> 16)
+	return w.writeAll(append(chunk, w.appHeader...))
+}
+
+// WriteBlock encodes p as exactly one data block, bypassing the chunking done
+// by Write, for callers that manage their own block boundaries.  p may be at
+// most MaxBlockSize bytes; larger blocks are rejected with a
+// *RecordTooLargeError and the stream is left unmodified.  An empty p is
+// written as an empty block.  Output written with WriteBlock is block-aligned
+// and can be consumed block for block with Reader.ReadBlock or
+// Reader.ReadMessage.
+func (w *Writer) WriteBlock(p []byte) error {
+	if w.mu != nil {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+	}
+
+	if w.err != nil {
+		return w.err
+	}
+	if len(p) > w.maxBlock {
+		return &RecordTooLargeError{Length: len(p), Limit: w.maxBlock}
+	}
+	_, w.err = w.write(p)
+	return w.err
+}
+
+// WriteRecord encodes p as exactly one data block so that block boundaries in
+// the stream coincide with record boundaries, as expected by
+// Reader.ReadMessage.  Records may be at most MaxBlockSize bytes.  WriteRecord
+// is equivalent to WriteBlock.
+func (w *Writer) WriteRecord(p []byte) error {
+	return w.WriteBlock(p)
+}
+
+// Write encodes p and writes it to the underlying writer as one or more
+// blocks before returning.  Unless w was created with WithAdaptiveBlockSize, a
+// call with at most MaxBlockSize bytes writes exactly one block, which a
+// Reader returns whole from ReadMessage; larger writes are divided into
+// blocks of MaxBlockSize bytes.  With WithSingleBlockWrites, writes that would
+// be divided are rejected instead.
+//
+// A write of no data is a no-op that returns 0 and writes nothing, not even
+// the stream identifier, which is written before the first block or by
+// WriteHeader.  Use WriteBlock to write an empty block.  WithSingleBlockWrites
+// is the exception, under which every Write, even an empty one, writes a
+// block.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.mu != nil {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+	}
+
+	return w.writeBlocks(p)
+}
+
+// WriteCounted is like Write but also returns the number of bytes written to
+// the underlying writer by the call, including any stream identifier and
+// block headers, for accounting of the bandwidth used by compressed data.
+func (w *Writer) WriteCounted(p []byte) (uncompressed int, compressed int, err error) {
+	if w.mu != nil {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+	}
+
+	start := w.written
+	uncompressed, err = w.writeBlocks(p)
+	return uncompressed, int(w.written - start), err
+}
+
+// writeBlocks implements Write.
+func (w *Writer) writeBlocks(p []byte) (int, error) {
 	if w.err != nil {
 		return 0, w.err
 	}
+	if w.singleBlockWrites {
+		if len(p) > w.maxBlock {
+			return 0, &RecordTooLargeError{Length: len(p), Limit: w.maxBlock}
+		}
+		_, w.err = w.write(p)
+		if w.err != nil {
+			return 0, w.err
+		}
+		return len(p), nil
+	}
 
 	total := 0
-	sz := MaxBlockSize
 	var n int
 	for i := 0; i < len(p); i += n {
+		sz := w.blockSize
 		if i+sz > len(p) {
 			sz = len(p) - i
 		}
@@ -152,6 +905,9 @@ func (w *writer) Write(p []byte) (int, error) {
 			return 0, w.err
 		}
 		total += n
+		if w.adaptive && !w.deterministic {
+			w.adaptBlockSize()
+		}
 	}
 	return total, nil
 }
@@ -159,59 +915,170 @@ func (w *writer) Write(p []byte) (int, error) {
 // write attempts to encode p as a block and write it to the underlying writer.
 // The returned int may not equal p's length if compression below
 // MaxBlockSize-4 could not be achieved.
-func (w *writer) write(p []byte) (int, error) {
+func (w *Writer) write(p []byte) (int, error) {
 	var err error
 
 	if len(p) > MaxBlockSize {
 		return 0, errors.New(fmt.Sprintf("block too large %d > %d", len(p), MaxBlockSize))
 	}
 
-	w.dst = w.dst[:cap(w.dst)] // Encode does dumb resize w/o context. reslice avoids alloc.
-	w.dst, err = snappy.Encode(w.dst, p)
-	if err != nil {
-		return 0, err
-	}
-	block := w.dst
 	n := len(p)
-	compressed := true
+	block := p[:n]
+	compressed := false
+
+	if !w.noCompression {
+		w.dst = w.dst[:cap(w.dst)] // Encode does dumb resize w/o context. reslice avoids alloc.
+		w.dst, err = w.encode(w.dst, p)
+		if err != nil {
+			return 0, err
+		}
 
-	// check for data which is better left uncompressed.  this is determined if
-	// the encoded content is longer than the source.
-	if len(w.dst) >= len(p) {
-		compressed = false
-		block = p[:n]
+		// check for data which is better left uncompressed.  this is
+		// determined if the encoded content is not sufficiently shorter
+		// than the source (see WithMinCompressionRatio).
+		if float64(len(w.dst)) < float64(len(p))*w.minRatio {
+			compressed = true
+			block = w.dst
+		}
 	}
 
-	if !w.sentStreamID {
-		_, err := w.writer.Write(streamID)
+	err = w.writeStreamID()
+	if err != nil {
+		return 0, err
+	}
+	if w.resyncInterval > 0 && w.sinceResync >= w.resyncInterval {
+		err = w.writeAll(streamID)
+		if err != nil {
+			return 0, err
+		}
+		w.sinceResync = 0
+	}
+	if w.blockLengthSidecar {
+		err = w.writeBlockLength(n)
 		if err != nil {
 			return 0, err
 		}
-		w.sentStreamID = true
 	}
 
 	// set the block type
+	checksum := maskChecksumWith(crc32.Checksum(p[:n], w.crcTable), w.checksumMask)
 	if compressed {
-		writeHeader(w.hdr, blockCompressed, block, p[:n])
+		writeHeaderChecksum(w.hdr, blockCompressed, block, checksum)
 	} else {
-		writeHeader(w.hdr, blockUncompressed, block, p[:n])
+		writeHeaderChecksum(w.hdr, blockUncompressed, block, checksum)
 	}
 
-	_, err = w.writer.Write(w.hdr)
+	err = w.writeAll(w.hdr)
 	if err != nil {
 		return 0, err
 	}
 
-	_, err = w.writer.Write(block)
+	err = w.writeAll(block)
 	if err != nil {
 		return 0, err
 	}
+	if w.flushEachBlock {
+		err = w.flushUnderlying()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if w.streamChecksum {
+		w.streamCRC = crc32.Update(w.streamCRC, crcTable, p[:n])
+	}
+	if w.streamDigest != nil {
+		w.streamDigest.Write(p[:n])
+	}
+
+	w.recordRatio(len(block), n)
+	w.committed += int64(n)
+	w.committedLen = w.written
+	w.sinceResync += int64(len(w.hdr) + len(block))
 
 	return n, nil
 }
 
+// CommittedOffset returns the number of decoded bytes contained in blocks that
+// were successfully written to the underlying writer.  The offset is always at
+// a block boundary.  Because blocks are independent, a failed stream may be
+// resumed by truncating the output to CommittedLen, which discards any chunk
+// torn by the failure, seeking the source data to the committed offset and
+// appending the output of a new Writer.  The additional stream identifier is
+// permitted by the format.
+func (w *Writer) CommittedOffset() int64 {
+	if w.mu != nil {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+	}
+
+	return w.committed
+}
+
+// CommittedLen returns the number of bytes w had written to the underlying
+// writer when the last block counted by CommittedOffset was complete, or 0 if
+// there is no such block.  The output of w may extend beyond it if a later
+// write failed part way through a chunk.
+func (w *Writer) CommittedLen() int64 {
+	if w.mu != nil {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+	}
+
+	return w.committedLen
+}
+
+// ratioWeight is the weight given to the most recent block in the moving
+// average reported by Writer.AverageBlockRatio.
+const ratioWeight = 0.1
+
+// recordRatio records the ratio of an emitted block of enclen bytes holding
+// declen bytes of data.
+func (w *Writer) recordRatio(enclen, declen int) {
+	if declen == 0 {
+		return
+	}
+	w.lastRatio = float64(enclen) / float64(declen)
+	if w.avgRatio == 0 {
+		w.avgRatio = w.lastRatio
+	} else {
+		w.avgRatio += ratioWeight * (w.lastRatio - w.avgRatio)
+	}
+}
+
+// LastBlockRatio returns the ratio of emitted block data length to input
+// length for the most recent block written by w.  A block that was emitted
+// uncompressed has a ratio of 1.  LastBlockRatio returns 0 if no block has
+// been written.
+func (w *Writer) LastBlockRatio() float64 {
+	if w.mu != nil {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+	}
+
+	return w.lastRatio
+}
+
+// AverageBlockRatio returns an exponentially weighted moving average of the
+// ratios reported by LastBlockRatio, giving the most recent block a weight of
+// 0.1.  AverageBlockRatio returns 0 if no block has been written.
+func (w *Writer) AverageBlockRatio() float64 {
+	if w.mu != nil {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+	}
+
+	return w.avgRatio
+}
+
 // writeHeader panics if len(hdr) is less than 8.
 func writeHeader(hdr []byte, btype byte, enc, dec []byte) {
+	writeHeaderChecksum(hdr, btype, enc, maskChecksum(crc32.Checksum(dec, crcTable)))
+}
+
+// writeHeaderChecksum is like writeHeader but writes the given masked
+// checksum.
+func writeHeaderChecksum(hdr []byte, btype byte, enc []byte, checksum uint32) {
 	hdr[0] = btype
 
 	// 3 byte little endian length of encoded content
@@ -221,7 +1088,6 @@ func writeHeader(hdr []byte, btype byte, enc, dec []byte) {
 	hdr[3] = byte(length >> 16)
 
 	// 4 byte little endian CRC32 checksum of decoded content
-	checksum := maskChecksum(crc32.Checksum(dec, crcTable))
 	hdr[4] = byte(checksum)
 	hdr[5] = byte(checksum >> 8)
 	hdr[6] = byte(checksum >> 16)
@@ -1,10 +1,18 @@
 package snappystream
 
 import (
+	"bufio"
 	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 // This test ensures that all BufferedWriter methods fail after Close has been
@@ -16,16 +24,48 @@ func TestBufferedWriterClose(t *testing.T) {
 		log.Fatalf("closing empty BufferedWriter: %v", err)
 	}
 	err = w.Close()
-	if err == nil {
-		log.Fatalf("successful close after close")
+	if err != ErrWriterClosed {
+		log.Fatalf("close after close: %v", err)
 	}
 	err = w.Flush()
-	if err == nil {
-		log.Fatalf("successful flush after close")
+	if err != ErrWriterClosed {
+		log.Fatalf("flush after close: %v", err)
 	}
 	_, err = w.Write([]byte("abc"))
-	if err == nil {
-		log.Fatalf("successful write after close")
+	if err != ErrWriterClosed {
+		log.Fatalf("write after close: %v", err)
+	}
+}
+
+// This test checks that a closed Writer reports ErrWriterClosed and writes
+// nothing more to the underlying writer.
+func TestWriterClosed(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	_, err := w.Write([]byte("before close"))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	n := buf.Len()
+
+	_, err = w.Write([]byte("after close"))
+	if err != ErrWriterClosed {
+		t.Fatalf("write after close: %v", err)
+	}
+	err = w.WriteBlock([]byte("after close"))
+	if err != ErrWriterClosed {
+		t.Fatalf("write block after close: %v", err)
+	}
+	err = w.Close()
+	if err != ErrWriterClosed {
+		t.Fatalf("close after close: %v", err)
+	}
+	if buf.Len() != n {
+		t.Fatalf("wrote %d bytes after close", buf.Len()-n)
 	}
 }
 
@@ -124,3 +164,1057 @@ func TestBufferedWriterFlush(t *testing.T) {
 		t.Fatalf("unexpected bytes")
 	}
 }
+
+// This test checks that WriteHeader emits the stream identifier exactly once.
+func TestWriterWriteHeader(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	err := w.WriteHeader()
+	if err != nil {
+		t.Fatalf("write header: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), streamID) {
+		t.Fatalf("unexpected header %x", buf.Bytes())
+	}
+	err = w.WriteHeader()
+	if err != nil {
+		t.Fatalf("write header: %v", err)
+	}
+	_, err = w.Write([]byte("hello header"))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if bytes.Count(buf.Bytes(), streamID) != 1 {
+		t.Fatalf("stream identifier written more than once")
+	}
+
+	var bbuf bytes.Buffer
+	bw := NewBufferedWriter(&bbuf)
+	err = bw.WriteHeader()
+	if err != nil {
+		t.Fatalf("buffered write header: %v", err)
+	}
+	if !bytes.Equal(bbuf.Bytes(), streamID) {
+		t.Fatalf("unexpected buffered header %x", bbuf.Bytes())
+	}
+}
+
+// This test checks that WithNoCompression emits only uncompressed blocks.
+func TestWriterNoCompression(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithNoCompression())
+	p := make([]byte, MaxBlockSize+100) // maximally compressible
+	_, err := w.Write(p)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	chunks, err := DescribeStream(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("describe: %v", err)
+	}
+	if len(chunks) != 3 {
+		t.Fatalf("unexpected chunks %+v", chunks)
+	}
+	for _, c := range chunks[1:] {
+		if c.Type != blockUncompressed || !c.ChecksumValid {
+			t.Fatalf("unexpected chunk %+v", c)
+		}
+	}
+
+	b, err := ioutil.ReadAll(NewReader(&buf, VerifyChecksum))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(b, p) {
+		t.Fatalf("unequal decompressed content")
+	}
+}
+
+// This test checks that AutoFlush flushes buffered data after a period of
+// inactivity.
+func TestBufferedWriterAutoFlush(t *testing.T) {
+	var mu sync.Mutex
+	var buf bytes.Buffer
+	w := NewBufferedWriter(&lockedWriter{mu: &mu, w: &buf})
+	w.AutoFlush(10 * time.Millisecond)
+
+	_, err := w.Write([]byte("hello auto flush"))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := buf.Len()
+		mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("buffered data was not flushed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	mu.Lock()
+	b, err := ioutil.ReadAll(NewReader(&buf, VerifyChecksum))
+	mu.Unlock()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(b) != "hello auto flush" {
+		t.Fatalf("read: %q", b)
+	}
+}
+
+// lockedWriter is an io.Writer that serializes writes to w with mu.
+type lockedWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+// This test checks the block compression ratios reported by a Writer.
+func TestWriterBlockRatio(t *testing.T) {
+	w := NewWriter(ioutil.Discard)
+	if w.LastBlockRatio() != 0 || w.AverageBlockRatio() != 0 {
+		t.Fatalf("ratio reported before writing")
+	}
+
+	_, err := w.Write(make([]byte, 10000))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	constant := w.LastBlockRatio()
+	if constant <= 0 || constant >= 0.1 {
+		t.Fatalf("constant data ratio %g", constant)
+	}
+	if w.AverageBlockRatio() != constant {
+		t.Fatalf("average ratio %g != %g", w.AverageBlockRatio(), constant)
+	}
+
+	_, err = w.Write([]byte("abc"))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if w.LastBlockRatio() != 1 {
+		t.Fatalf("uncompressed data ratio %g", w.LastBlockRatio())
+	}
+	avg := w.AverageBlockRatio()
+	if avg <= constant || avg >= 1 {
+		t.Fatalf("average ratio %g", avg)
+	}
+}
+
+// This test checks that Close finalizes the stream and only closes the
+// underlying writer when requested.
+func TestWriterCloseUnderlying(t *testing.T) {
+	var buf bytes.Buffer
+	c := &closeRecorder{Writer: &buf}
+	w := NewWriter(c)
+	err := w.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if c.closed {
+		t.Fatalf("underlying writer closed")
+	}
+	if !bytes.Equal(buf.Bytes(), streamID) {
+		t.Fatalf("unexpected stream %x", buf.Bytes())
+	}
+
+	c = &closeRecorder{Writer: ioutil.Discard}
+	bw := NewBufferedWriter(c, WithCloseUnderlying())
+	_, err = bw.Write([]byte("hello"))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	err = bw.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if !c.closed {
+		t.Fatalf("underlying writer not closed")
+	}
+}
+
+// closeRecorder is an io.WriteCloser that records whether it was closed.
+type closeRecorder struct {
+	io.Writer
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+// This test checks that CommittedOffset and CommittedLen report data written
+// to the underlying writer at block boundaries, from which a stream torn by a
+// failed write can be resumed.
+func TestWriterCommittedOffset(t *testing.T) {
+	var buf bytes.Buffer
+	fw := &failingWriter{w: &buf, n: 3} // stream identifier + one block
+	w := NewWriter(fw)
+	p := bytes.Repeat([]byte("resumable upload "), 10000)
+
+	_, err := w.Write(p)
+	if err == nil {
+		t.Fatalf("write: expected error")
+	}
+	off := w.CommittedOffset()
+	if off != MaxBlockSize {
+		t.Fatalf("committed offset %d", off)
+	}
+	if w.CommittedLen() >= int64(buf.Len()) {
+		t.Fatalf("committed length %d of %d bytes", w.CommittedLen(), buf.Len())
+	}
+
+	// resume the stream from the committed offset.
+	buf.Truncate(int(w.CommittedLen()))
+	w = NewWriter(&buf)
+	_, err = w.Write(p[off:])
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if w.CommittedOffset() != int64(len(p))-off {
+		t.Fatalf("committed offset %d", w.CommittedOffset())
+	}
+	b, err := ioutil.ReadAll(NewReader(&buf, VerifyChecksum))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(b, p) {
+		t.Fatalf("unequal decompressed content")
+	}
+
+	bw := NewBufferedWriter(ioutil.Discard)
+	bw.Write([]byte("buffered"))
+	if bw.CommittedOffset() != 0 {
+		t.Fatalf("buffered data committed")
+	}
+	bw.Close()
+	if bw.CommittedOffset() != 8 {
+		t.Fatalf("committed offset %d after close", bw.CommittedOffset())
+	}
+	if bw.CommittedLen() != int64(len(streamID)+8+8) {
+		t.Fatalf("committed length %d after close", bw.CommittedLen())
+	}
+}
+
+// failingWriter is an io.Writer that forwards n calls to Write to w and fails
+// all calls after that, forwarding half of the data of the first failed call.
+type failingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		w.n--
+		m, _ := w.w.Write(p[:len(p)/2])
+		return m, fmt.Errorf("write failed")
+	}
+	if w.n < 0 {
+		return 0, fmt.Errorf("write failed")
+	}
+	w.n--
+	return w.w.Write(p)
+}
+
+// This test checks that an app header written with WithAppHeader follows the
+// stream identifier and is exposed by Reader.AppHeader.
+func TestWriterAppHeader(t *testing.T) {
+	header := []byte("MAGIC\x01\x00")
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithAppHeader(header))
+	_, err := w.Write([]byte("hello app header"))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes()[len(streamID)+4:len(streamID)+4+len(header)], header) {
+		t.Fatalf("header not found after stream identifier: %q", buf.Bytes())
+	}
+
+	r := NewReader(&buf, true)
+	if r.AppHeader() != nil {
+		t.Fatalf("app header before reading: %q", r.AppHeader())
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(b) != "hello app header" {
+		t.Fatalf("decoded %q", b)
+	}
+	if !bytes.Equal(r.AppHeader(), header) {
+		t.Fatalf("app header %q", r.AppHeader())
+	}
+
+	w = NewWriter(ioutil.Discard, WithAppHeader(make([]byte, MaxBlockSize+1)))
+	_, err = w.Write([]byte("x"))
+	if err == nil {
+		t.Fatalf("write succeeded with oversized app header")
+	}
+}
+
+// This test checks that a default Reader skips a foreign app header chunk too
+// large to have been written by WithAppHeader instead of rejecting the stream.
+func TestReaderOversizeAppHeader(t *testing.T) {
+	stream := bytes.Join([][]byte{
+		streamID,
+		opaqueChunk(chunkAppHeader, 100000),
+		compressedChunk(t, []byte("after the header")),
+	}, nil)
+	r := NewReader(bytes.NewReader(stream), true)
+	p, err := ioutil.ReadAll(r)
+	if err != nil || string(p) != "after the header" {
+		t.Fatalf("read %q (%v)", p, err)
+	}
+	if r.AppHeader() != nil {
+		t.Fatalf("app header %d bytes", len(r.AppHeader()))
+	}
+}
+
+// This test checks that WriteRecord emits one block per record, including
+// empty records, and rejects records too large for a block.
+func TestWriterWriteRecord(t *testing.T) {
+	records := [][]byte{[]byte("one"), {}, bytes.Repeat([]byte("x"), MaxBlockSize)}
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, rec := range records {
+		err := w.WriteRecord(rec)
+		if err != nil {
+			t.Fatalf("write record: %v", err)
+		}
+	}
+	err := w.WriteRecord(make([]byte, MaxBlockSize+1))
+	if !errors.Is(err, ErrRecordTooLarge) {
+		t.Fatalf("write oversized record: %v", err)
+	}
+	err = w.WriteRecord([]byte("after"))
+	if err != nil {
+		t.Fatalf("write record after oversized record: %v", err)
+	}
+	records = append(records, []byte("after"))
+
+	r := NewReader(&buf, true)
+	for i, rec := range records {
+		p, err := r.ReadMessage()
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		if !bytes.Equal(p, rec) {
+			t.Fatalf("record %d: got %d bytes, want %d", i, len(p), len(rec))
+		}
+	}
+	_, err = r.ReadMessage()
+	if err != io.EOF {
+		t.Fatalf("read past last record: %v", err)
+	}
+}
+
+// This test checks that a BufferedWriter created with WithMaxLatencyBlockSize
+// writes small writes immediately and buffers large ones.
+func TestBufferedWriterMaxLatencyBlockSize(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewBufferedWriter(&buf, WithMaxLatencyBlockSize(100))
+
+	_, err := w.Write(bytes.Repeat([]byte("bulk"), 100))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("large write was not buffered")
+	}
+
+	_, err = w.Write([]byte("small"))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	r := NewReader(bytes.NewReader(buf.Bytes()), true)
+	var blocks []string
+	for {
+		p, err := r.ReadMessage()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		blocks = append(blocks, string(p))
+	}
+	if len(blocks) != 2 || len(blocks[0]) != 400 || blocks[1] != "small" {
+		t.Fatalf("unexpected blocks %q", blocks)
+	}
+}
+
+// This test checks that with WithDeterministicBlocks a BufferedWriter produces
+// the same blocks however the data is divided among calls to Write, Flush and
+// ReadFrom, and that every block but the last holds the configured size.
+func TestBufferedWriterDeterministicBlocks(t *testing.T) {
+	encode := func(sizes []int, opts ...WriterOption) []byte {
+		var buf bytes.Buffer
+		w := NewBufferedWriter(&buf, opts...)
+		p := testDataMan
+		for i := 0; len(p) > 0; i++ {
+			n := sizes[i%len(sizes)]
+			if n > len(p) {
+				n = len(p)
+			}
+			if _, err := w.Write(p[:n]); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatalf("flush: %v", err)
+			}
+			p = p[n:]
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	for _, size := range []int{1000, MaxBlockSize} {
+		opt := WithDeterministicBlocks(size)
+		a := encode([]int{len(testDataMan)}, opt, WithMaxLatencyBlockSize(100))
+		b := encode([]int{1, 7, 4096, 3, 70000}, opt, WithMaxLatencyBlockSize(100))
+		if !bytes.Equal(a, b) {
+			t.Fatalf("size %d: output depends on write boundaries", size)
+		}
+
+		var buf bytes.Buffer
+		w := NewBufferedWriter(&buf, opt)
+		if _, err := w.ReadFrom(iotest.OneByteReader(bytes.NewReader(testDataMan))); err != nil {
+			t.Fatalf("read from: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		if !bytes.Equal(buf.Bytes(), a) {
+			t.Fatalf("size %d: ReadFrom output differs from Write output", size)
+		}
+
+		r := NewReader(bytes.NewReader(a), true)
+		var n int
+		for {
+			p, err := r.ReadMessage()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			if len(p) != size && n+len(p) != len(testDataMan) {
+				t.Fatalf("size %d: block of %d bytes at %d", size, len(p), n)
+			}
+			n += len(p)
+		}
+		if n != len(testDataMan) {
+			t.Fatalf("size %d: decoded %d bytes, want %d", size, n, len(testDataMan))
+		}
+	}
+}
+
+// This test checks that empty writes are no-ops that write neither blocks nor
+// the stream identifier.
+func TestWriterEmptyWrite(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, p := range [][]byte{nil, {}} {
+		n, err := w.Write(p)
+		if n != 0 || err != nil {
+			t.Fatalf("write %q: %d, %v", p, n, err)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("empty writes wrote %x", buf.Bytes())
+	}
+
+	_, err := w.Write([]byte("data"))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_, err = w.Write(nil)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	r := NewReader(bytes.NewReader(buf.Bytes()), true)
+	p, err := r.ReadMessage()
+	if err != nil || string(p) != "data" {
+		t.Fatalf("read %q (%v)", p, err)
+	}
+	_, err = r.ReadMessage()
+	if err != io.EOF {
+		t.Fatalf("unexpected block after empty write (%v)", err)
+	}
+
+	// an empty write does not flush a BufferedWriter.
+	buf.Reset()
+	bw := NewBufferedWriter(&buf, WithMaxLatencyBlockSize(100))
+	_, err = bw.Write(bytes.Repeat([]byte("bulk"), 100))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	n, err := bw.Write(nil)
+	if n != 0 || err != nil {
+		t.Fatalf("write: %d, %v", n, err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("empty write flushed %x", buf.Bytes())
+	}
+}
+
+// This test checks that errors from the underlying writer are returned
+// wrapped, with the cause available to errors.Is, and that the error is
+// sticky.
+func TestWriterSinkErrorChain(t *testing.T) {
+	cause := errors.New("connection reset")
+	w := NewWriter(unwritable(cause))
+	for i := 0; i < 2; i++ {
+		_, err := w.Write([]byte("fail"))
+		if !errors.Is(err, cause) || err == cause {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+}
+
+// This test checks that FramedLenUpperBound bounds the length of encoded
+// streams, including incompressible ones.
+func TestFramedLenUpperBound(t *testing.T) {
+	for _, n := range []int{0, 1, MaxBlockSize - 1, MaxBlockSize, MaxBlockSize + 1, 5*MaxBlockSize + 17} {
+		p := make([]byte, n)
+		_, err := rand.Read(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		_, err = w.Write(p)
+		if err != nil {
+			t.Fatalf("write %d bytes: %v", n, err)
+		}
+		err = w.Close()
+		if err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		if bound := FramedLenUpperBound(n); buf.Len() > bound {
+			t.Fatalf("encoded %d bytes to %d > bound %d", n, buf.Len(), bound)
+		}
+	}
+}
+
+// This test checks that WithHeaderOnEmpty controls the output of a Writer
+// closed without writing any data.
+func TestWriterHeaderOnEmpty(t *testing.T) {
+	for _, test := range []struct {
+		opts []WriterOption
+		want []byte
+	}{
+		{nil, streamID},
+		{[]WriterOption{WithHeaderOnEmpty(true)}, streamID},
+		{[]WriterOption{WithHeaderOnEmpty(false)}, nil},
+		{[]WriterOption{WithHeaderOnEmpty(false), WithStreamChecksum()}, nil},
+	} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, test.opts...)
+		err := w.Close()
+		if err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		if !bytes.Equal(buf.Bytes(), test.want) {
+			t.Fatalf("closed empty writer to %x, want %x", buf.Bytes(), test.want)
+		}
+	}
+
+	// data written to the writer is framed as usual.
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithHeaderOnEmpty(false))
+	_, err := w.Write([]byte("not empty"))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), streamID) || bytes.Count(buf.Bytes(), streamID) != 1 {
+		t.Fatalf("unexpected stream %x", buf.Bytes())
+	}
+}
+
+// This test checks that a Writer created with WithMutex can be shared by
+// concurrent writers without interleaving blocks.  Run it with -race.
+func TestWriterMutex(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithMutex())
+	const msgLen = 3*MaxBlockSize + 100 // several blocks
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(c byte) {
+			defer wg.Done()
+			msg := bytes.Repeat([]byte{c}, msgLen)
+			for j := 0; j < 10; j++ {
+				_, err := w.Write(msg)
+				if err != nil {
+					t.Errorf("write: %v", err)
+					return
+				}
+				w.CommittedOffset()
+			}
+		}(byte('a' + i))
+	}
+	wg.Wait()
+	err := w.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	b, err := ioutil.ReadAll(NewReader(&buf, true))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if len(b) != 80*msgLen {
+		t.Fatalf("read %d bytes", len(b))
+	}
+	for i := 0; i < len(b); i += msgLen {
+		msg := b[i : i+msgLen]
+		if bytes.Count(msg, msg[:1]) != msgLen {
+			t.Fatalf("writes were interleaved at offset %d", i)
+		}
+	}
+}
+
+// This test checks that WithResyncInterval repeats the stream identifier at
+// the expected cadence and that the stream decodes fully.
+func TestWriterResyncInterval(t *testing.T) {
+	data := make([]byte, 20*MaxBlockSize)
+	_, err := rand.Read(data) // incompressible so blocks have a known size
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithResyncInterval(4*MaxBlockSize))
+	_, err = w.Write(data)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	// each block is MaxBlockSize+8 bytes, so an identifier follows every
+	// fourth block.
+	stream := buf.Bytes()
+	if n := bytes.Count(stream, streamID); n != 5 {
+		t.Fatalf("found %d stream identifiers", n)
+	}
+	blockLen := MaxBlockSize + 8
+	for i := 1; i < 5; i++ {
+		off := len(streamID) + i*(4*blockLen+len(streamID)) - len(streamID)
+		if !bytes.Equal(stream[off:off+len(streamID)], streamID) {
+			t.Fatalf("stream identifier %d not found at offset %d", i, off)
+		}
+	}
+
+	b, err := ioutil.ReadAll(NewReader(&buf, true))
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Fatalf("decoded data does not match")
+	}
+}
+
+// This test checks that WriteBlock emits exactly one block per call.
+func TestWriterWriteBlock(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	blocks := [][]byte{bytes.Repeat([]byte("a"), MaxBlockSize), []byte("b")}
+	for _, p := range blocks {
+		err := w.WriteBlock(p)
+		if err != nil {
+			t.Fatalf("write block: %v", err)
+		}
+	}
+	err := w.WriteBlock(make([]byte, MaxBlockSize+1))
+	if !errors.Is(err, ErrRecordTooLarge) {
+		t.Fatalf("write oversized block: %v", err)
+	}
+
+	r := NewReader(&buf, true)
+	for i, want := range blocks {
+		p, err := r.ReadBlock(nil)
+		if err != nil {
+			t.Fatalf("block %d: %v", i, err)
+		}
+		if !bytes.Equal(p, want) {
+			t.Fatalf("block %d: read %d bytes, want %d", i, len(p), len(want))
+		}
+	}
+	if r.DataBlocks() != 2 {
+		t.Fatalf("read %d blocks", r.DataBlocks())
+	}
+}
+
+// This test checks that a Reader reports GracefulEOF only for streams
+// finished with the terminal marker written by WithTerminalMarker.
+func TestWriterTerminalMarker(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithTerminalMarker())
+	_, err := w.Write([]byte("finished"))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	stream := buf.Bytes()
+
+	r := NewReader(bytes.NewReader(stream), true)
+	b, err := ioutil.ReadAll(r)
+	if err != nil || string(b) != "finished" {
+		t.Fatalf("read %q (%v)", b, err)
+	}
+	if !r.GracefulEOF() {
+		t.Fatalf("terminal marker not seen")
+	}
+
+	// the stream truncated at a chunk boundary before the marker.
+	r = NewReader(bytes.NewReader(stream[:len(stream)-4]), true)
+	b, err = ioutil.ReadAll(r)
+	if err != nil || string(b) != "finished" {
+		t.Fatalf("read %q (%v)", b, err)
+	}
+	if r.GracefulEOF() {
+		t.Fatalf("graceful EOF without terminal marker")
+	}
+}
+
+// This test checks that a Writer created with WithPreallocatedDst does not
+// allocate when writing full blocks of either compressible or incompressible
+// data.
+func TestWriterPreallocatedDst(t *testing.T) {
+	random := make([]byte, MaxBlockSize)
+	_, err := rand.Read(random)
+	if err != nil {
+		t.Fatalf("rand: %v", err)
+	}
+	for _, p := range [][]byte{random, make([]byte, MaxBlockSize)} {
+		w := NewWriter(ioutil.Discard, WithPreallocatedDst())
+		allocs := testing.AllocsPerRun(10, func() {
+			_, err := w.Write(p)
+			if err != nil {
+				t.Fatalf("write: %v", err)
+			}
+		})
+		if allocs != 0 {
+			t.Errorf("%v allocations per write", allocs)
+		}
+	}
+}
+
+// This test checks that WithMinCompressionRatio stores blocks uncompressed
+// unless compression saves enough space.
+func TestWriterMinCompressionRatio(t *testing.T) {
+	random := make([]byte, MaxBlockSize)
+	_, err := rand.Read(random)
+	if err != nil {
+		t.Fatalf("rand: %v", err)
+	}
+	constant := make([]byte, MaxBlockSize)
+
+	for _, test := range []struct {
+		name  string
+		p     []byte
+		ratio float64
+		btype byte
+	}{
+		{"random", random, 1, blockUncompressed},
+		{"random", random, 2, blockUncompressed},
+		{"constant", constant, 1, blockCompressed},
+		{"constant", constant, 0.1, blockCompressed},
+		{"constant", constant, 0.01, blockUncompressed},
+	} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, WithMinCompressionRatio(test.ratio))
+		_, err := w.Write(test.p)
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+
+		chunks, err := DescribeStream(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("describe: %v", err)
+		}
+		if len(chunks) != 2 || chunks[1].Type != test.btype {
+			t.Errorf("%s ratio %v: unexpected chunks %+v", test.name, test.ratio, chunks)
+		}
+
+		b, err := ioutil.ReadAll(NewReader(&buf, VerifyChecksum))
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if !bytes.Equal(b, test.p) {
+			t.Errorf("%s ratio %v: unequal decompressed content", test.name, test.ratio)
+		}
+	}
+}
+
+// shortWriter accepts at most n bytes of each write without reporting an
+// error, violating the io.Writer contract.
+type shortWriter struct {
+	n int
+}
+
+func (w shortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		return w.n, nil
+	}
+	return len(p), nil
+}
+
+// This test checks that a short write by the underlying writer is reported
+// as io.ErrShortWrite.
+func TestWriterShortWrite(t *testing.T) {
+	// the stream identifier is written in full but the block is not.
+	w := NewWriter(shortWriter{len(streamID)})
+	_, err := w.Write([]byte("short write"))
+	if err != io.ErrShortWrite {
+		t.Fatalf("write: %v", err)
+	}
+
+	w = NewWriter(shortWriter{1})
+	err = w.Close()
+	if err != io.ErrShortWrite {
+		t.Fatalf("close: %v", err)
+	}
+}
+
+// sliceWriter records the slices written to it without copying them.
+type sliceWriter struct {
+	writes [][]byte
+}
+
+func (w *sliceWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, p)
+	return len(p), nil
+}
+
+// This test checks that the write path does not copy block data: the data of
+// an uncompressed block is passed to the underlying writer as given, the
+// encoded data of a compressed block is written directly from the Writer's
+// buffer, and no allocations are made per block.
+func TestWriterNoCopy(t *testing.T) {
+	random := make([]byte, MaxBlockSize)
+	_, err := rand.Read(random)
+	if err != nil {
+		t.Fatalf("rand: %v", err)
+	}
+
+	var sw sliceWriter
+	w := NewWriter(&sw, WithPreallocatedDst(), WithBlockLengthSidecar())
+	_, err = w.Write(random)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	// stream identifier, sidecar, header and block data.
+	if len(sw.writes) != 4 || &sw.writes[3][0] != &random[0] {
+		t.Fatalf("uncompressed block data was copied")
+	}
+
+	constant := make([]byte, MaxBlockSize)
+	sw.writes = nil
+	_, err = w.Write(constant)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if len(sw.writes) != 3 || &sw.writes[2][0] != &w.dst[0] {
+		t.Fatalf("compressed block data was copied")
+	}
+
+	allocs := testing.AllocsPerRun(10, func() {
+		_, err := w.Write(random)
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		sw.writes = sw.writes[:0]
+	})
+	if allocs != 0 {
+		t.Errorf("%v allocations per write", allocs)
+	}
+}
+
+// flushRecorder is a buffered writer in the style of http.ResponseWriter,
+// recording what has been flushed.
+type flushRecorder struct {
+	buf     bytes.Buffer
+	flushed []int
+}
+
+func (f *flushRecorder) Write(p []byte) (int, error) {
+	return f.buf.Write(p)
+}
+
+func (f *flushRecorder) Flush() {
+	f.flushed = append(f.flushed, f.buf.Len())
+}
+
+// This test checks that WithFlushEachBlock flushes the underlying writer after
+// each block and when the stream is closed.
+func TestWriterFlushEachBlock(t *testing.T) {
+	var f flushRecorder
+	w := NewWriter(&f, WithFlushEachBlock(), WithTerminalMarker())
+	_, err := w.Write(make([]byte, MaxBlockSize+1))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if len(f.flushed) != 2 || f.flushed[1] != f.buf.Len() {
+		t.Fatalf("flushed %v of %d bytes", f.flushed, f.buf.Len())
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if len(f.flushed) != 3 || f.flushed[2] != f.buf.Len() {
+		t.Fatalf("flushed %v of %d bytes", f.flushed, f.buf.Len())
+	}
+
+	// a Flush method returning an error is also supported.
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	w = NewWriter(bw, WithFlushEachBlock())
+	_, err = w.Write([]byte("flushed"))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if bw.Buffered() != 0 || buf.Len() == 0 {
+		t.Fatalf("bufio.Writer not flushed")
+	}
+}
+
+// This test checks that data appended to an existing stream with NewAppender
+// decodes as part of a single stream.
+func TestAppender(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	_, err := w.Write([]byte("first "))
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	for _, s := range []string{"second ", "third"} {
+		n := buf.Len()
+		w = NewAppender(&buf)
+		_, err = w.Write([]byte(s))
+		if err != nil {
+			t.Fatalf("append: %v", err)
+		}
+		err = w.Close()
+		if err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		if bytes.HasPrefix(buf.Bytes()[n:], streamID) {
+			t.Fatalf("appender wrote a stream identifier")
+		}
+	}
+
+	b, err := ioutil.ReadAll(NewReader(&buf, VerifyChecksum))
+	if err != nil || string(b) != "first second third" {
+		t.Fatalf("read %q (%v)", b, err)
+	}
+}
+
+// This test checks that each Write of at most MaxBlockSize bytes is read back
+// as one message, and that WithSingleBlockWrites rejects larger writes.
+func TestWriterSingleBlockWrites(t *testing.T) {
+	msgs := [][]byte{[]byte("one"), make([]byte, MaxBlockSize), bytes.Repeat([]byte("three"), 100)}
+	for _, opts := range [][]WriterOption{nil, {WithSingleBlockWrites()}} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, opts...)
+		for _, p := range msgs {
+			_, err := w.Write(p)
+			if err != nil {
+				t.Fatalf("write: %v", err)
+			}
+		}
+		r := NewReader(&buf, VerifyChecksum)
+		for i, want := range msgs {
+			p, err := r.ReadMessage()
+			if err != nil || !bytes.Equal(p, want) {
+				t.Fatalf("message %d: %v", i, err)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithSingleBlockWrites())
+	n, err := w.Write(make([]byte, MaxBlockSize+1))
+	if !errors.Is(err, ErrRecordTooLarge) || n != 0 || buf.Len() != 0 {
+		t.Fatalf("oversize write %d, %v wrote %d bytes", n, err, buf.Len())
+	}
+	_, err = w.Write([]byte("after"))
+	if err != nil {
+		t.Fatalf("write after rejected write: %v", err)
+	}
+	p, err := NewReader(&buf, VerifyChecksum).ReadMessage()
+	if err != nil || string(p) != "after" {
+		t.Fatalf("read %q (%v)", p, err)
+	}
+}
+
+// This test checks that a BufferedWriter created with WithSingleBlockWrites
+// accepts writes larger than MaxBlockSize, dividing them into blocks.
+func TestBufferedWriterSingleBlockWrites(t *testing.T) {
+	p := bytes.Repeat(testDataMan, 200)
+	var buf bytes.Buffer
+	w := NewBufferedWriter(&buf, WithSingleBlockWrites())
+	_, err := w.Write(p)
+	if err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	b, err := ioutil.ReadAll(NewReader(&buf, VerifyChecksum))
+	if err != nil || !bytes.Equal(b, p) {
+		t.Fatalf("read %d bytes (%v)", len(b), err)
+	}
+}
+
+// This test checks that WriteCounted reports the bytes written to the
+// underlying writer.
+func TestWriterWriteCounted(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	total := 0
+	for _, p := range [][]byte{[]byte("counted"), make([]byte, MaxBlockSize+1), nil} {
+		n, c, err := w.WriteCounted(p)
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if n != len(p) {
+			t.Errorf("wrote %d of %d bytes", n, len(p))
+		}
+		total += c
+		if total != buf.Len() {
+			t.Errorf("counted %d of %d bytes", total, buf.Len())
+		}
+	}
+}